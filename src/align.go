@@ -0,0 +1,200 @@
+//
+// Alignment of messages from multiple read streams by their SensorOutput.Timestamp (e.g. the camera frame and the IMU sample
+// that are closest in time), for sensor fusion. The first stream is the reference, every message on it is paired with the
+// nearest (or interpolated) message of every other stream, within a tolerance.
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
+)
+
+// The maximum amount of messages that is buffered per stream, older messages are dropped
+const alignerBufferSize = 64
+
+// Creates a message at the given timestamp from the two messages around it
+type Interpolator func(before *rovercom.SensorOutput, after *rovercom.SensorOutput, timestamp uint64) *rovercom.SensorOutput
+
+type alignedMessage struct {
+	output *rovercom.SensorOutput
+	// Whether this message was part of an emitted tuple, messages that never were are counted as dropped
+	used bool
+}
+
+type Aligner struct {
+	streams     []*ReadStream
+	tolerance   int64 // ms, like the timestamps
+	buffers     [][]alignedMessage
+	interpolate Interpolator
+	dropped     uint64
+}
+
+// The partner that was found for a reference message in one of the other streams
+type alignedPartner struct {
+	output *rovercom.SensorOutput
+	used   []int // indices of the buffered messages that make up the partner
+	keep   int   // index of the first buffered message that can still be a partner for later reference messages
+}
+
+// Create an aligner over the given streams, the first of which is the reference stream.
+// Messages are only paired if their timestamps are at most tolerance apart.
+func NewAligner(tolerance time.Duration, streams ...*ReadStream) (*Aligner, error) {
+	if len(streams) < 2 {
+		return nil, fmt.Errorf("Cannot align fewer than two streams")
+	}
+	for i, stream := range streams {
+		if stream == nil {
+			return nil, fmt.Errorf("Cannot align nil stream at position %d", i)
+		}
+	}
+	if tolerance < 0 {
+		return nil, fmt.Errorf("Tolerance %s must not be negative", tolerance)
+	}
+
+	return &Aligner{
+		streams:   streams,
+		tolerance: tolerance.Milliseconds(),
+		buffers:   make([][]alignedMessage, len(streams)),
+	}, nil
+}
+
+// Interpolate between the messages around a reference message, instead of picking the nearest one.
+// The nearest message is still used when there is no message on both sides within the tolerance.
+func (a *Aligner) SetInterpolator(interpolate Interpolator) {
+	a.interpolate = interpolate
+}
+
+// Get the amount of messages that were dropped because they never found a partner
+func (a *Aligner) Dropped() uint64 {
+	return a.dropped
+}
+
+// Read from the streams until the next aligned tuple is complete. The tuple holds one message per stream, in the order
+// that the streams were passed to NewAligner.
+func (a *Aligner) Next() ([]*rovercom.SensorOutput, error) {
+	for {
+		tuple, waiting := a.align()
+		if tuple != nil {
+			return tuple, nil
+		}
+
+		output, err := a.streams[waiting].Read()
+		if err != nil {
+			return nil, err
+		}
+		a.push(waiting, output)
+	}
+}
+
+// Buffer a message that was read from the stream at index
+func (a *Aligner) push(index int, output *rovercom.SensorOutput) {
+	a.buffers[index] = append(a.buffers[index], alignedMessage{output: output})
+	if len(a.buffers[index]) > alignerBufferSize {
+		a.discard(index, 1)
+	}
+}
+
+// Remove the first n buffered messages of the stream at index, counting those that were never used
+func (a *Aligner) discard(index int, n int) {
+	for _, msg := range a.buffers[index][:n] {
+		if !msg.used {
+			a.dropped++
+		}
+	}
+	a.buffers[index] = a.buffers[index][n:]
+}
+
+// Returns the next aligned tuple, or nil and the index of the stream that needs to be read before a tuple can be formed
+func (a *Aligner) align() ([]*rovercom.SensorOutput, int) {
+	for {
+		if len(a.buffers[0]) == 0 {
+			return nil, 0
+		}
+		timestamp := int64(a.buffers[0][0].output.Timestamp)
+
+		// Later messages might still be closer, until a stream has a message at or after the reference
+		for i := 1; i < len(a.buffers); i++ {
+			buffer := a.buffers[i]
+			if len(buffer) == 0 || int64(buffer[len(buffer)-1].output.Timestamp) < timestamp {
+				return nil, i
+			}
+		}
+
+		partners := make([]alignedPartner, len(a.buffers))
+		complete := true
+		for i := 1; i < len(a.buffers); i++ {
+			partner, ok := a.partner(i, timestamp)
+			if !ok {
+				complete = false
+				break
+			}
+			partners[i] = partner
+		}
+
+		if !complete {
+			// The reference message never finds a partner, and neither do messages that are too old for the next one
+			a.discard(0, 1)
+			for i := 1; i < len(a.buffers); i++ {
+				n := 0
+				for n < len(a.buffers[i]) && int64(a.buffers[i][n].output.Timestamp) < timestamp-a.tolerance {
+					n++
+				}
+				a.discard(i, n)
+			}
+			continue
+		}
+
+		tuple := make([]*rovercom.SensorOutput, len(a.buffers))
+		tuple[0] = a.buffers[0][0].output
+		a.buffers[0][0].used = true
+		a.discard(0, 1)
+		for i := 1; i < len(a.buffers); i++ {
+			tuple[i] = partners[i].output
+			for _, j := range partners[i].used {
+				a.buffers[i][j].used = true
+			}
+			a.discard(i, partners[i].keep)
+		}
+		return tuple, -1
+	}
+}
+
+// Find the partner for a reference message at timestamp in the stream at index, which has a message at or after timestamp
+func (a *Aligner) partner(index int, timestamp int64) (alignedPartner, bool) {
+	buffer := a.buffers[index]
+	after := 0
+	for int64(buffer[after].output.Timestamp) < timestamp {
+		after++
+	}
+	afterDistance := int64(buffer[after].output.Timestamp) - timestamp
+	before := after - 1
+	beforeDistance := int64(-1)
+	if before >= 0 {
+		beforeDistance = timestamp - int64(buffer[before].output.Timestamp)
+	}
+
+	if a.interpolate != nil && afterDistance > 0 && before >= 0 && beforeDistance <= a.tolerance && afterDistance <= a.tolerance {
+		return alignedPartner{
+			output: a.interpolate(buffer[before].output, buffer[after].output, uint64(timestamp)),
+			used:   []int{before, after},
+			keep:   before,
+		}, true
+	}
+
+	nearest, distance := after, afterDistance
+	if before >= 0 && beforeDistance < afterDistance {
+		nearest, distance = before, beforeDistance
+	}
+	if distance > a.tolerance {
+		return alignedPartner{}, false
+	}
+	return alignedPartner{
+		output: buffer[nearest].output,
+		used:   []int{nearest},
+		keep:   nearest,
+	}, true
+}
@@ -0,0 +1,92 @@
+package roverlib
+
+import (
+	"testing"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
+)
+
+func sensorOutput(timestamp uint64) *rovercom.SensorOutput {
+	return &rovercom.SensorOutput{Timestamp: timestamp}
+}
+
+func newTestAligner(t *testing.T) *Aligner {
+	aligner, err := NewAligner(10*time.Millisecond, &ReadStream{}, &ReadStream{})
+	if err != nil {
+		t.Fatalf("NewAligner returned %v", err)
+	}
+	return aligner
+}
+
+// Tests that reference messages are paired with the nearest message within the tolerance, and that unpaired messages are counted
+func TestAlignNearest(t *testing.T) {
+	aligner := newTestAligner(t)
+
+	aligner.push(0, sensorOutput(100))
+	if tuple, waiting := aligner.align(); tuple != nil || waiting != 1 {
+		t.Fatalf("align() = %v, %d, want to wait for stream 1", tuple, waiting)
+	}
+	aligner.push(1, sensorOutput(95))
+	aligner.push(1, sensorOutput(104))
+	tuple, _ := aligner.align()
+	if tuple == nil || tuple[0].Timestamp != 100 || tuple[1].Timestamp != 104 {
+		t.Fatalf("align() = %v, want (100, 104)", tuple)
+	}
+
+	aligner.push(0, sensorOutput(200))
+	aligner.push(1, sensorOutput(150))
+	aligner.push(1, sensorOutput(198))
+	aligner.push(1, sensorOutput(260))
+	tuple, _ = aligner.align()
+	if tuple == nil || tuple[0].Timestamp != 200 || tuple[1].Timestamp != 198 {
+		t.Fatalf("align() = %v, want (200, 198)", tuple)
+	}
+
+	// No partner within the tolerance
+	aligner.push(0, sensorOutput(300))
+	aligner.push(1, sensorOutput(330))
+	if tuple, waiting := aligner.align(); tuple != nil || waiting != 0 {
+		t.Fatalf("align() = %v, %d, want to wait for stream 0", tuple, waiting)
+	}
+
+	// 95, 150, 260 and 300 never found a partner
+	if dropped := aligner.Dropped(); dropped != 4 {
+		t.Fatalf("Dropped() = %d, want 4", dropped)
+	}
+}
+
+// Tests that the interpolator is used when there are messages on both sides of the reference
+func TestAlignInterpolated(t *testing.T) {
+	aligner := newTestAligner(t)
+	aligner.SetInterpolator(func(before *rovercom.SensorOutput, after *rovercom.SensorOutput, timestamp uint64) *rovercom.SensorOutput {
+		if before.Timestamp != 96 || after.Timestamp != 106 {
+			t.Fatalf("interpolating between %d and %d, want 96 and 106", before.Timestamp, after.Timestamp)
+		}
+		return sensorOutput(timestamp)
+	})
+
+	aligner.push(0, sensorOutput(100))
+	aligner.push(1, sensorOutput(96))
+	aligner.push(1, sensorOutput(106))
+	tuple, _ := aligner.align()
+	if tuple == nil || tuple[1].Timestamp != 100 {
+		t.Fatalf("align() = %v, want an interpolated message at 100", tuple)
+	}
+	if dropped := aligner.Dropped(); dropped != 0 {
+		t.Fatalf("Dropped() = %d, want 0", dropped)
+	}
+}
+
+// Tests that invalid aligners are rejected
+func TestNewAlignerInvalid(t *testing.T) {
+	if _, err := NewAligner(time.Millisecond, &ReadStream{}); err == nil {
+		t.Fatalf("expected error for a single stream")
+	}
+	if _, err := NewAligner(time.Millisecond, &ReadStream{}, nil); err == nil {
+		t.Fatalf("expected error for a nil stream")
+	}
+	if _, err := NewAligner(-time.Millisecond, &ReadStream{}, &ReadStream{}); err == nil {
+		t.Fatalf("expected error for a negative tolerance")
+	}
+}
@@ -0,0 +1,153 @@
+//
+// Binding of configuration options into a user-defined struct, using `roverlib:"name"` tags, e.g.
+//
+//	type config struct {
+//		MaxIterations int64  `roverlib:"max-iterations"`
+//		LogLevel      string `roverlib:"log-level"`
+//	}
+//
+// Bound structs are kept up to date as OTA tuning values arrive. Updates are applied under the configuration lock,
+// so read a bound struct from within Locked() if tuning is enabled.
+//
+
+package roverlib
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/rs/zerolog/log"
+)
+
+const bindTag = "roverlib"
+
+// A struct that was bound to the configuration, with the index of the field for every option name
+type binding struct {
+	target reflect.Value
+	fields map[string]int
+}
+
+// Fill the struct that target points to with the configuration values named in its `roverlib` tags and keep it up to date.
+// All missing options, extra options and type mismatches are reported at once.
+func (c *ServiceConfiguration) Bind(target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can only bind to a non-nil pointer to a struct, got %T", target)
+	}
+	b := binding{
+		target: ptr.Elem(),
+		fields: make(map[string]int),
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var errs []error
+	structType := b.target.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, ok := field.Tag.Lookup(bindTag)
+		if !ok || name == "" || name == "-" {
+			continue
+		}
+		if !field.IsExported() {
+			errs = append(errs, fmt.Errorf("field %s for option %s is not exported", field.Name, name))
+			continue
+		}
+
+		value, ok := c.valueLocked(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("missing option %s for field %s", name, field.Name))
+			continue
+		}
+		if err := assignField(b.target.Field(i), value); err != nil {
+			errs = append(errs, fmt.Errorf("option %s for field %s: %w", name, field.Name, err))
+			continue
+		}
+		b.fields[name] = i
+	}
+
+	// Every option must be bound, so that options that are added to the service.yaml are not silently ignored
+	for _, name := range c.namesLocked() {
+		if _, ok := b.fields[name]; !ok && !bindsOption(structType, name) {
+			errs = append(errs, fmt.Errorf("extra option %s is not bound to any field", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to bind configuration to %s: %w", structType.Name(), errors.Join(errs...))
+	}
+	c.bindings = append(c.bindings, b)
+	return nil
+}
+
+// Run fn while holding the configuration read lock, so that bound structs can be read without racing with tuning updates
+func (c *ServiceConfiguration) Locked(fn func()) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	fn()
+}
+
+// Whether the struct type has a field tagged with the given option name
+func bindsOption(structType reflect.Type, name string) bool {
+	for i := 0; i < structType.NumField(); i++ {
+		if tag, ok := structType.Field(i).Tag.Lookup(bindTag); ok && tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Assign a configuration value to a struct field, if their types are compatible
+func assignField(field reflect.Value, value interface{}) error {
+	switch v := value.(type) {
+	case float64:
+		if field.Kind() == reflect.Float64 || field.Kind() == reflect.Float32 {
+			field.SetFloat(v)
+			return nil
+		}
+	case int64:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if field.OverflowInt(v) {
+				return fmt.Errorf("value %d overflows %s", v, field.Type())
+			}
+			field.SetInt(v)
+			return nil
+		}
+	case string:
+		if field.Kind() == reflect.String {
+			field.SetString(v)
+			return nil
+		}
+	case bool:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(v)
+			return nil
+		}
+	case []float64, []string:
+		// Values are copies already, so they can be handed out as is
+		if reflect.TypeOf(v).AssignableTo(field.Type()) {
+			field.Set(reflect.ValueOf(v))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot assign %T to field of type %s", value, field.Type())
+}
+
+// Update all bound structs with the current value of an option, the caller must hold the write lock
+func (c *ServiceConfiguration) updateBindingsLocked(name string) {
+	value, ok := c.valueLocked(name)
+	if !ok {
+		return
+	}
+	for _, b := range c.bindings {
+		if i, ok := b.fields[name]; ok {
+			if err := assignField(b.target.Field(i), value); err != nil {
+				log.Warn().Err(err).Str("name", name).Msg("Failed to update bound configuration field")
+			}
+		}
+	}
+}
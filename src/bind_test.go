@@ -0,0 +1,54 @@
+package roverlib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that a struct is filled from the configuration and kept up to date with tuning values
+func TestBind(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	var bound struct {
+		Float  float64 `roverlib:"float1"`
+		String string  `roverlib:"string1"`
+		Other  int
+	}
+
+	if err := cfg.Bind(&bound); err != nil {
+		t.Fatalf("Bind returned %v", err)
+	}
+	if bound.Float != 3.14 || bound.String != "auto" {
+		t.Fatalf("bound = %+v, want float1 = 3.14 and string1 = auto", bound)
+	}
+
+	cfg.applyTuning(numberTuning(uint64(time.Now().UnixMilli())+1000, "float1", 1.5))
+	cfg.Locked(func() {
+		if bound.Float != 1.5 {
+			t.Fatalf("bound.Float = %v after tuning, want 1.5", bound.Float)
+		}
+	})
+}
+
+// Tests that missing options, extra options and type mismatches are all reported in one error
+func TestBindErrors(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	var bound struct {
+		Config1 string  `roverlib:"config1"`
+		Missing float64 `roverlib:"missing"`
+	}
+
+	err := cfg.Bind(&bound)
+	if err == nil {
+		t.Fatalf("expected Bind to fail")
+	}
+	for _, want := range []string{"config1", "missing option missing", "extra option config2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+
+	if err := cfg.Bind(bound); err == nil {
+		t.Fatalf("expected Bind to fail for a non-pointer")
+	}
+}
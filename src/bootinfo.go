@@ -15,6 +15,10 @@ import (
 func UnmarshalService(data []byte) (Service, error) {
 	var r Service
 	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return r, err
+	}
+	err = r.checkCompatibility()
 	return r, err
 }
 
@@ -35,6 +39,18 @@ type Service struct {
 	// The specific version of the service
 	Version *string     `json:"version,omitempty"`
 	Service interface{} `json:"service"`
+	// (If enabled) the heartbeat that this service publishes periodically
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+	// The resolved request/reply dependencies
+	Requests []Request `json:"requests,omitempty"`
+	// The request/reply endpoints served by this service
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	// Where updated input resolutions are received from at runtime (optional)
+	Rewiring *Rewiring `json:"rewiring,omitempty"`
+	// Authentication and encryption of streams with CurveZMQ (optional)
+	Security *Security `json:"security,omitempty"`
+	// The version of the bootspec schema (1.0 if not set)
+	Bootspec *string `json:"bootspec,omitempty"`
 }
 
 type Configuration struct {
@@ -44,8 +60,23 @@ type Configuration struct {
 	Tunable *bool `json:"tunable,omitempty"`
 	// The type of this configuration option
 	Type *Type `json:"type,omitempty"`
-	// The value of this configuration option, which can be a string or float
+	// The value of this configuration option, which can be a string, float, bool or an array of these
 	Value *Value `json:"value"`
+	// Optional constraints that (tuned) values of this configuration option must satisfy
+	Constraints *Constraints `json:"constraints,omitempty"`
+}
+
+type Constraints struct {
+	// The minimum value (inclusive) of a number option
+	Min *float64 `json:"min,omitempty"`
+	// The maximum value (inclusive) of a number option
+	Max *float64 `json:"max,omitempty"`
+	// The increment that a number option must be a multiple of (counted from the minimum, or zero)
+	Step *float64 `json:"step,omitempty"`
+	// The only values that this option can take
+	Allowed []Value `json:"allowed,omitempty"`
+	// A regular expression that a string option must match
+	Pattern *string `json:"pattern,omitempty"`
 }
 
 type Input struct {
@@ -66,6 +97,32 @@ type Output struct {
 	Address *string `json:"address,omitempty"`
 	// Name of the output published by this service
 	Name *string `json:"name,omitempty"`
+	// How messages written to this output are compressed (optional)
+	Compression *Compression `json:"compression,omitempty"`
+}
+
+type Compression struct {
+	// The codec to compress with (gzip or flate)
+	Codec *string `json:"codec,omitempty"`
+	// Messages smaller than this amount of bytes are not compressed
+	Threshold *int64 `json:"threshold,omitempty"`
+}
+
+type Request struct {
+	// The name of the service that serves these endpoints
+	Service   *string    `json:"service,omitempty"`
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+}
+
+type Endpoint struct {
+	// The (zmq) socket address that requests are sent to (or served on)
+	Address *string `json:"address,omitempty"`
+	// Name of the endpoint
+	Name *string `json:"name,omitempty"`
+	// How long to wait for a reply before retrying, in milliseconds
+	Timeout *int64 `json:"timeout,omitempty"`
+	// How many times to retry a request that timed out
+	Retries *int64 `json:"retries,omitempty"`
 }
 
 type Tuning struct {
@@ -75,22 +132,64 @@ type Tuning struct {
 	Enabled *bool `json:"enabled,omitempty"`
 }
 
+// Where roverd publishes updated input resolutions (e.g. after restarting a producer on a new port).
+// Updates are lists of inputs, in the same format as the inputs of the service definition.
+type Rewiring struct {
+	// The (zmq) socket address that updates are published on
+	Address *string `json:"address,omitempty"`
+	// The path of a file that is watched for updates
+	File *string `json:"file,omitempty"`
+	// The interval between two checks of the watched file, in milliseconds
+	Interval *int64 `json:"interval,omitempty"`
+}
+
+// CurveZMQ keys are Z85-encoded (40 characters). Every key can be given in the bootspec or in the key directory, where
+// <service>.key holds the public key of a service and <name>.secret the secret key of this service.
+type Security struct {
+	// Whether streams are authenticated and encrypted
+	Enabled *bool `json:"enabled,omitempty"`
+	// The public key of this service
+	Public *string `json:"public,omitempty"`
+	// The secret key of this service
+	Secret *string `json:"secret,omitempty"`
+	// The directory to read keys from that are not in the bootspec
+	Keys *string `json:"keys,omitempty"`
+	// The public keys of other services by service name (use "tuning" for the publisher of tuning values and "roverd" for the publisher of input resolutions)
+	Peers map[string]string `json:"peers,omitempty"`
+}
+
+type Heartbeat struct {
+	// (If enabled) the (zmq) socket address that heartbeats are published on
+	Address *string `json:"address,omitempty"`
+	// Whether or not heartbeats are published
+	Enabled *bool `json:"enabled,omitempty"`
+	// The interval between two heartbeats, in milliseconds
+	Interval *int64 `json:"interval,omitempty"`
+}
+
 // The type of this configuration option
 type Type string
 
 const (
-	Number Type = "number"
-	String Type = "string"
+	Number      Type = "number"
+	String      Type = "string"
+	Integer     Type = "integer"
+	Boolean     Type = "boolean"
+	NumberArray Type = "number-array"
+	StringArray Type = "string-array"
 )
 
-// The value of this configuration option, which can be a string or float
+// The value of this configuration option, which can be a string, float, bool or an array of these
 type Value struct {
 	Double *float64
 	String *string
+	Bool   *bool
+	Array  []Value
 }
 
 func (x *Value) UnmarshalJSON(data []byte) error {
-	_, err := unmarshalUnion(data, nil, &x.Double, nil, &x.String, false, nil, false, nil, false, nil, false, nil, false)
+	x.Array = nil
+	_, err := unmarshalUnion(data, nil, &x.Double, &x.Bool, &x.String, true, &x.Array, false, nil, false, nil, false, nil, false)
 	if err != nil {
 		return err
 	}
@@ -98,7 +197,7 @@ func (x *Value) UnmarshalJSON(data []byte) error {
 }
 
 func (x *Value) MarshalJSON() ([]byte, error) {
-	return marshalUnion(nil, x.Double, nil, x.String, false, nil, false, nil, false, nil, false, nil, false)
+	return marshalUnion(nil, x.Double, x.Bool, x.String, x.Array != nil, x.Array, false, nil, false, nil, false, nil, false)
 }
 
 func unmarshalUnion(data []byte, pi **int64, pf **float64, pb **bool, ps **string, haveArray bool, pa interface{}, haveObject bool, pc interface{}, haveMap bool, pm interface{}, haveEnum bool, pe interface{}, nullable bool) (bool, error) {
@@ -0,0 +1,156 @@
+//
+// Notifications for configuration changes, so that the user program can re-derive values (e.g. PID gains) only when
+// they actually change, instead of polling the configuration
+//
+
+package roverlib
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Size of the channel buffer of a watcher, changes are dropped when a watcher does not keep up
+const watchBufferSize = 32
+
+// A single change of a configuration option
+type ConfigChange struct {
+	Name      string
+	Old       interface{}
+	New       interface{}
+	Version   uint64    // the configuration version that this change was applied in
+	Timestamp time.Time // when the change was applied
+	Source    string    // where the change came from (e.g. "tuning", "endpoint", "persisted", "rollback" or "override")
+}
+
+// Sources of changes
+const (
+	sourceTuning    = "tuning"
+	sourceEndpoint  = "endpoint"
+	sourcePersisted = "persisted"
+	sourceRollback  = "rollback"
+	sourceOverride  = "override"
+)
+
+type listeners struct {
+	lock     sync.Mutex
+	onChange map[string][]func(old, new interface{})
+	watchers []chan ConfigChange
+	// Writes accepted changes to the state file (nil if persistence is not enabled)
+	persistence *persistence
+	// Bounded history of applied changes, oldest first
+	history        []ConfigChange
+	historyDropped bool
+}
+
+// Register a callback that is called whenever the value of the configuration option with the given name changes.
+// Callbacks are called from the goroutine that applied the change, without holding the configuration lock.
+func (c *ServiceConfiguration) OnChange(name string, callback func(old, new interface{})) {
+	c.listeners.lock.Lock()
+	defer c.listeners.lock.Unlock()
+
+	c.listeners.onChange[name] = append(c.listeners.onChange[name], callback)
+}
+
+// Same as OnChange, but for float configuration options only
+func (c *ServiceConfiguration) OnFloatChange(name string, callback func(old, new float64)) {
+	c.OnChange(name, func(old, new interface{}) {
+		o, ok1 := old.(float64)
+		n, ok2 := new.(float64)
+		if ok1 && ok2 {
+			callback(o, n)
+		}
+	})
+}
+
+// Same as OnChange, but for string configuration options only
+func (c *ServiceConfiguration) OnStringChange(name string, callback func(old, new string)) {
+	c.OnChange(name, func(old, new interface{}) {
+		o, ok1 := old.(string)
+		n, ok2 := new.(string)
+		if ok1 && ok2 {
+			callback(o, n)
+		}
+	})
+}
+
+// Returns a channel that receives every change of any configuration option, until the context is cancelled
+func (c *ServiceConfiguration) Watch(ctx context.Context) <-chan ConfigChange {
+	ch := make(chan ConfigChange, watchBufferSize)
+
+	c.listeners.lock.Lock()
+	c.listeners.watchers = append(c.listeners.watchers, ch)
+	c.listeners.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.listeners.lock.Lock()
+		defer c.listeners.lock.Unlock()
+		for i, w := range c.listeners.watchers {
+			if w == ch {
+				c.listeners.watchers = append(c.listeners.watchers[:i], c.listeners.watchers[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Returns the version of the configuration, which is bumped on every applied tuning state
+func (c *ServiceConfiguration) Version() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.version
+}
+
+// Set the source of all changes
+func stamp(changes []*ConfigChange, source string) {
+	for _, change := range changes {
+		if change != nil {
+			change.Source = source
+		}
+	}
+}
+
+// Notify all callbacks and watchers of the given changes (nil changes are skipped).
+// Must not be called while holding the configuration lock, so that callbacks can read the configuration.
+func (c *ServiceConfiguration) notify(changes ...*ConfigChange) {
+	c.listeners.lock.Lock()
+	p := c.listeners.persistence
+	c.listeners.lock.Unlock()
+	// Overrides only apply to this run, so they are not persisted as tuned values
+	if p != nil && slices.ContainsFunc(changes, func(change *ConfigChange) bool { return change != nil && change.Source != sourceOverride }) {
+		p.save(slices.DeleteFunc(slices.Clone(changes), func(change *ConfigChange) bool { return change == nil || change.Source == sourceOverride }))
+	}
+
+	for _, change := range changes {
+		if change == nil {
+			continue
+		}
+
+		// Callbacks are called without holding the listeners lock, so that they can register new listeners
+		c.listeners.lock.Lock()
+		c.listeners.record(*change)
+		callbacks := append([]func(old, new interface{}){}, c.listeners.onChange[change.Name]...)
+		for _, w := range c.listeners.watchers {
+			select {
+			case w <- *change:
+			default:
+				log.Warn().Str("name", change.Name).Msg("Configuration watcher does not keep up, dropping change")
+			}
+		}
+		c.listeners.lock.Unlock()
+
+		for _, callback := range callbacks {
+			callback(change.Old, change.New)
+		}
+	}
+}
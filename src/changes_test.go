@@ -0,0 +1,58 @@
+package roverlib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Tests that callbacks are only called for actual changes of the option they are registered for
+func TestOnChange(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+
+	calls := 0
+	cfg.OnFloatChange("float1", func(old, new float64) {
+		calls++
+		if old != 3.14 || new != 2.71 {
+			t.Errorf("OnFloatChange(%v, %v), want (3.14, 2.71)", old, new)
+		}
+	})
+
+	cfg.setFloat("float1", 2.71)
+	cfg.setFloat("float1", 2.71) // same value, no change
+	cfg.setString("string1", "manual")
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+}
+
+// Tests that watchers receive changes until their context is cancelled
+func TestWatch(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := cfg.Watch(ctx)
+
+	cfg.applyTuning(numberTuning(uint64(time.Now().UnixMilli())+1000, "float1", 1.5))
+
+	select {
+	case change := <-changes:
+		if change.Name != "float1" || change.New != 1.5 || change.Version != 1 {
+			t.Fatalf("change = %+v, want float1 = 1.5 in version 1", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no change received")
+	}
+	if cfg.Version() != 1 {
+		t.Fatalf("Version() = %d, want 1", cfg.Version())
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatalf("expected channel to be closed after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("channel not closed after cancel")
+	}
+}
@@ -0,0 +1,175 @@
+//
+// Optional compression of stream payloads (e.g. camera frames consumed remotely over Wi-Fi). Compressed messages are wrapped
+// in an envelope that read streams detect and decompress transparently, uncompressed messages are sent as is.
+//
+// The envelope is a marker, followed by the codec and the compressed payload. The marker starts with a zero byte, which never
+// starts a protobuf message (field number 0 is invalid), so it cannot be confused with a plain rovercom message.
+//
+
+package roverlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Used when neither the bootspec nor the user program specifies a threshold
+const defaultCompressionThreshold = 1024 // bytes
+
+// Decompressed messages larger than this are rejected, so that a small message cannot expand without bound
+const maxDecompressedSize = 64 << 20 // bytes
+
+// The prefix of every compressed message
+var compressionMarker = []byte{0x00, 'r', 'z'}
+
+type Codec byte
+
+const (
+	CodecNone  Codec = 0
+	CodecGzip  Codec = 1
+	CodecFlate Codec = 2
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecFlate:
+		return "flate"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+// Convert the name of a codec (as used in the bootspec) to a Codec
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "", "none":
+		return CodecNone, nil
+	case "gzip":
+		return CodecGzip, nil
+	case "flate":
+		return CodecFlate, nil
+	default:
+		return CodecNone, fmt.Errorf("unsupported codec %q (supported are gzip and flate)", name)
+	}
+}
+
+// The compression settings of a write stream
+type writeCompression struct {
+	codec     Codec
+	threshold int
+}
+
+// Compress messages written to the stream that are at least threshold bytes large with the given codec.
+// Overrides the compression declared in the bootspec, CodecNone disables compression.
+func (s *WriteStream) SetCompression(codec Codec, threshold int) error {
+	if codec != CodecNone && codec != CodecGzip && codec != CodecFlate {
+		return fmt.Errorf("Unsupported codec %s", codec)
+	}
+	if threshold < 0 {
+		return fmt.Errorf("Compression threshold %d must not be negative", threshold)
+	}
+	s.compression = writeCompression{codec: codec, threshold: threshold}
+	return nil
+}
+
+// Read the compression settings of an output from the bootspec
+func outputCompression(output Output) writeCompression {
+	res := writeCompression{threshold: defaultCompressionThreshold}
+	if output.Compression == nil {
+		return res
+	}
+	if output.Compression.Codec != nil {
+		// Invalid codecs are reported by Validate, they disable compression here
+		res.codec, _ = ParseCodec(*output.Compression.Codec)
+	}
+	if output.Compression.Threshold != nil && *output.Compression.Threshold >= 0 {
+		res.threshold = int(*output.Compression.Threshold)
+	}
+	return res
+}
+
+// Returns the data to send over the wire: the compressed envelope, or the data itself if it is below the threshold
+// or does not get any smaller
+func (c writeCompression) apply(data []byte) ([]byte, error) {
+	if c.codec == CodecNone || len(data) < c.threshold {
+		return uncompressed(data), nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(compressionMarker)
+	buf.WriteByte(byte(c.codec))
+	var writer io.WriteCloser
+	switch c.codec {
+	case CodecGzip:
+		writer = gzip.NewWriter(&buf)
+	case CodecFlate:
+		writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compress message: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compress message: %w", err)
+	}
+
+	if buf.Len() >= len(data) {
+		return uncompressed(data), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the data to send without compression. Data that looks like an envelope itself is wrapped, so that readers
+// do not mistake it for one
+func uncompressed(data []byte) []byte {
+	if !bytes.HasPrefix(data, compressionMarker) {
+		return data
+	}
+	res := append([]byte{}, compressionMarker...)
+	res = append(res, byte(CodecNone))
+	return append(res, data...)
+}
+
+// Returns the original message for data that was received over the wire, decompressing it if it is wrapped in an envelope
+func decompress(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, compressionMarker) || len(data) <= len(compressionMarker) {
+		return data, nil
+	}
+
+	codec := Codec(data[len(compressionMarker)])
+	payload := bytes.NewReader(data[len(compressionMarker)+1:])
+	var reader io.ReadCloser
+	switch codec {
+	case CodecNone:
+		return data[len(compressionMarker)+1:], nil
+	case CodecGzip:
+		gzipReader, err := gzip.NewReader(payload)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress message: %w", err)
+		}
+		reader = gzipReader
+	case CodecFlate:
+		reader = flate.NewReader(payload)
+	default:
+		return nil, fmt.Errorf("Failed to decompress message with unsupported %s", codec)
+	}
+	defer reader.Close()
+
+	// Read one byte more than the maximum, to tell a message of exactly the maximum size from a larger one
+	res, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decompress message: %w", err)
+	}
+	if len(res) > maxDecompressedSize {
+		return nil, fmt.Errorf("Failed to decompress message: larger than the maximum of %d bytes", maxDecompressedSize)
+	}
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package roverlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"testing"
+)
+
+// Tests that large messages are compressed and decompressed transparently with every codec
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("track-data "), 200)
+	for _, codec := range []Codec{CodecGzip, CodecFlate} {
+		compression := writeCompression{codec: codec, threshold: 1024}
+		wire, err := compression.apply(data)
+		if err != nil {
+			t.Fatalf("apply(%s) returned %v", codec, err)
+		}
+		if !bytes.HasPrefix(wire, compressionMarker) || len(wire) >= len(data) {
+			t.Fatalf("Expected %s to compress %d bytes, got %d bytes", codec, len(data), len(wire))
+		}
+
+		res, err := decompress(wire)
+		if err != nil {
+			t.Fatalf("decompress(%s) returned %v", codec, err)
+		}
+		if !bytes.Equal(res, data) {
+			t.Fatalf("decompress(%s) did not return the original message", codec)
+		}
+	}
+}
+
+// Tests that small messages and messages that look like an envelope are sent in a way that readers understand
+func TestCompressionThreshold(t *testing.T) {
+	compression := writeCompression{codec: CodecGzip, threshold: 1024}
+
+	small := []byte{0x08, 0x01}
+	wire, err := compression.apply(small)
+	if err != nil || !bytes.Equal(wire, small) {
+		t.Fatalf("apply() = %v, %v, want small message to be sent as is", wire, err)
+	}
+
+	envelope := append(append([]byte{}, compressionMarker...), 0x01)
+	wire, _ = writeCompression{}.apply(envelope)
+	if res, err := decompress(wire); err != nil || !bytes.Equal(res, envelope) {
+		t.Fatalf("decompress() = %v, %v, want message that looks like an envelope back", res, err)
+	}
+
+	// Incompressible data is sent uncompressed, so it has to be wrapped as well
+	noise := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(noise)
+	noise = append(append([]byte{}, compressionMarker...), noise...)
+	wire, err = compression.apply(noise)
+	if err != nil {
+		t.Fatalf("apply() returned %v", err)
+	}
+	if res, err := decompress(wire); err != nil || !bytes.Equal(res, noise) {
+		t.Fatalf("decompress() = %v, want incompressible message that looks like an envelope back", err)
+	}
+
+	if _, err := decompress(append(append([]byte{}, compressionMarker...), 0x7f, 0x00)); err == nil {
+		t.Fatalf("expected error for unsupported codec")
+	}
+}
+
+// Tests that messages that decompress to more than the maximum size are rejected
+func TestDecompressLimit(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(compressionMarker)
+	buf.WriteByte(byte(CodecGzip))
+	writer := gzip.NewWriter(&buf)
+	chunk := make([]byte, 1<<20)
+	for written := 0; written <= maxDecompressedSize; written += len(chunk) {
+		if _, err := writer.Write(chunk); err != nil {
+			t.Fatalf("Write returned %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close returned %v", err)
+	}
+
+	if _, err := decompress(buf.Bytes()); err == nil {
+		t.Fatalf("expected error for a message of %d compressed bytes that expands beyond the maximum", buf.Len())
+	}
+}
+
+// Tests that the compression of an output is read from the bootspec
+func TestOutputCompression(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"outputs": [
+			{"name": "camera-frames", "address": "tcp://*:7100", "compression": {"codec": "flate", "threshold": 4096}},
+			{"name": "camera-debug", "address": "tcp://*:7101", "compression": {"codec": "zstd"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	stream, err := service.WriteStreamE("camera-frames")
+	if err != nil {
+		t.Fatalf("WriteStreamE returned %v", err)
+	}
+	if stream.compression.codec != CodecFlate || stream.compression.threshold != 4096 {
+		t.Fatalf("compression = %+v, want flate with threshold 4096", stream.compression)
+	}
+	if err := service.Validate(); err == nil || !bytes.Contains([]byte(err.Error()), []byte("outputs[1].compression.codec")) {
+		t.Fatalf("Validate returned %v, want unsupported codec to be reported", err)
+	}
+}
@@ -4,7 +4,13 @@
 package roverlib
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,34 +19,85 @@ import (
 
 type ServiceConfiguration struct {
 	// Managed per type, because Go does not support easy union types
-	floatOptions  map[string]float64
-	stringOptions map[string]string
-	tunable       map[string]bool
+	floatOptions       map[string]float64
+	stringOptions      map[string]string
+	intOptions         map[string]int64
+	boolOptions        map[string]bool
+	floatSliceOptions  map[string][]float64
+	stringSliceOptions map[string][]string
+	tunable            map[string]bool
 	// For concurrency control
 	lock *sync.RWMutex
 	// Prevent late updates
 	lastUpdate uint64 // timestamp
+	// The subscriber that receives OTA tuning values (nil if tuning is disabled)
+	tuning *tuningSubscriber
+	// Bumped on every applied tuning state
+	version uint64
+	// Callbacks and channels that are notified of changes
+	listeners *listeners
+	// Constraints that (tuned) values must satisfy, and how many values were rejected because of them
+	constraints map[string]*constraint
+	rejections  uint64
+	// Structs and typed handles that are kept up to date with the configuration values
+	bindings []binding
+	handles  map[string][]func(value interface{})
 }
 
 func NewServiceConfiguration(service Service) *ServiceConfiguration {
 	config := &ServiceConfiguration{
-		floatOptions:  make(map[string]float64),
-		stringOptions: make(map[string]string),
-		tunable:       make(map[string]bool),
-		lock:          &sync.RWMutex{},
-		lastUpdate:    uint64(time.Now().UnixMilli()),
+		floatOptions:       make(map[string]float64),
+		stringOptions:      make(map[string]string),
+		intOptions:         make(map[string]int64),
+		boolOptions:        make(map[string]bool),
+		floatSliceOptions:  make(map[string][]float64),
+		stringSliceOptions: make(map[string][]string),
+		tunable:            make(map[string]bool),
+		lock:               &sync.RWMutex{},
+		lastUpdate:         uint64(time.Now().UnixMilli()),
+		listeners:          &listeners{onChange: make(map[string][]func(old, new interface{}))},
+		constraints:        make(map[string]*constraint),
+		handles:            make(map[string][]func(value interface{})),
 	}
 
 	for _, c := range service.Configuration {
+		// Invalid options are reported by Service.Validate, skip them instead of crashing
+		if c.Name == nil || c.Type == nil || c.Value == nil || validateValue(*c.Type, *c.Value) != nil {
+			log.Warn().Msg("Skipping invalid configuration option")
+			continue
+		}
+
 		switch *c.Type {
 		case Number:
 			config.floatOptions[*c.Name] = *c.Value.Double
 		case String:
 			config.stringOptions[*c.Name] = *c.Value.String
+		case Integer:
+			config.intOptions[*c.Name] = int64(*c.Value.Double)
+		case Boolean:
+			config.boolOptions[*c.Name] = *c.Value.Bool
+		case NumberArray:
+			values := make([]float64, 0, len(c.Value.Array))
+			for _, v := range c.Value.Array {
+				values = append(values, *v.Double)
+			}
+			config.floatSliceOptions[*c.Name] = values
+		case StringArray:
+			values := make([]string, 0, len(c.Value.Array))
+			for _, v := range c.Value.Array {
+				values = append(values, *v.String)
+			}
+			config.stringSliceOptions[*c.Name] = values
 		}
 		if c.Tunable != nil {
 			config.tunable[*c.Name] = *c.Tunable
 		}
+		if c.Constraints != nil {
+			err := config.Constrain(*c.Name, *c.Constraints)
+			if err != nil {
+				log.Warn().Err(err).Msg("Ignoring constraints from the bootspec")
+			}
+		}
 	}
 
 	return config
@@ -53,7 +110,7 @@ func NewServiceConfiguration(service Service) *ServiceConfiguration {
 
 // Returns the float value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
 // Reading is NOT thread-safe, but we accept the risks because we assume that the user program will read the configuration values repeatedly
-// If you want to read the configuration values concurrently, you should use the GetFloatSafe method
+// If you want to read the configuration values concurrently, you should use the GetFloatSafe method, or resolve a handle with Float(config, name)
 func (c *ServiceConfiguration) GetFloat(name string) (float64, error) {
 	value, ok := c.floatOptions[name]
 	if !ok {
@@ -71,7 +128,7 @@ func (c *ServiceConfiguration) GetFloatSafe(name string) (float64, error) {
 
 // Returns the string value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
 // Reading is NOT thread-safe, but we accept the risks because we assume that the user program will read the configuration values repeatedly
-// If you want to read the configuration values concurrently, you should use the GetStringSafe method
+// If you want to read the configuration values concurrently, you should use the GetStringSafe method, or resolve a handle with StringOption(config, name)
 func (c *ServiceConfiguration) GetString(name string) (string, error) {
 	value, ok := c.stringOptions[name]
 	if !ok {
@@ -87,32 +144,416 @@ func (c *ServiceConfiguration) GetStringSafe(name string) (string, error) {
 	return c.GetString(name)
 }
 
+// Returns the integer value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
+// Reading is NOT thread-safe, if you want to read the configuration values concurrently, you should use the GetIntSafe method
+func (c *ServiceConfiguration) GetInt(name string) (int64, error) {
+	value, ok := c.intOptions[name]
+	if !ok {
+		return 0, fmt.Errorf("no integer configuration option with name %s", name)
+	}
+	return value, nil
+}
+
+func (c *ServiceConfiguration) GetIntSafe(name string) (int64, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.GetInt(name)
+}
+
+// Returns the boolean value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
+// Reading is NOT thread-safe, if you want to read the configuration values concurrently, you should use the GetBoolSafe method
+func (c *ServiceConfiguration) GetBool(name string) (bool, error) {
+	value, ok := c.boolOptions[name]
+	if !ok {
+		return false, fmt.Errorf("no boolean configuration option with name %s", name)
+	}
+	return value, nil
+}
+
+func (c *ServiceConfiguration) GetBoolSafe(name string) (bool, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.GetBool(name)
+}
+
+// Returns a copy of the float array value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
+// Reading is NOT thread-safe, if you want to read the configuration values concurrently, you should use the GetFloatSliceSafe method
+func (c *ServiceConfiguration) GetFloatSlice(name string) ([]float64, error) {
+	value, ok := c.floatSliceOptions[name]
+	if !ok {
+		return nil, fmt.Errorf("no float array configuration option with name %s", name)
+	}
+	return slices.Clone(value), nil
+}
+
+func (c *ServiceConfiguration) GetFloatSliceSafe(name string) ([]float64, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.GetFloatSlice(name)
+}
+
+// Returns a copy of the string array value of the configuration option with the given name, returns an error if the option does not exist or does not exist for this type
+// Reading is NOT thread-safe, if you want to read the configuration values concurrently, you should use the GetStringSliceSafe method
+func (c *ServiceConfiguration) GetStringSlice(name string) ([]string, error) {
+	value, ok := c.stringSliceOptions[name]
+	if !ok {
+		return nil, fmt.Errorf("no string array configuration option with name %s", name)
+	}
+	return slices.Clone(value), nil
+}
+
+func (c *ServiceConfiguration) GetStringSliceSafe(name string) ([]string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.GetStringSlice(name)
+}
+
+// An immutable, consistent copy of all configuration values, so that a control loop can read all of its values
+// (e.g. every PID gain) from the same tuning state
+type ConfigSnapshot struct {
+	// A private copy of the configuration, that is never written to
+	config *ServiceConfiguration
+}
+
+// Returns a consistent copy of all configuration values (thread-safe)
+func (c *ServiceConfiguration) Snapshot() ConfigSnapshot {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return ConfigSnapshot{config: &ServiceConfiguration{
+		floatOptions:       maps.Clone(c.floatOptions),
+		stringOptions:      maps.Clone(c.stringOptions),
+		intOptions:         maps.Clone(c.intOptions),
+		boolOptions:        maps.Clone(c.boolOptions),
+		floatSliceOptions:  maps.Clone(c.floatSliceOptions),
+		stringSliceOptions: maps.Clone(c.stringSliceOptions),
+		version:            c.version,
+	}}
+}
+
+// Returns the float value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetFloat(name string) (float64, error) {
+	return s.config.GetFloat(name)
+}
+
+// Returns the string value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetString(name string) (string, error) {
+	return s.config.GetString(name)
+}
+
+// Returns the integer value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetInt(name string) (int64, error) {
+	return s.config.GetInt(name)
+}
+
+// Returns the boolean value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetBool(name string) (bool, error) {
+	return s.config.GetBool(name)
+}
+
+// Returns the float array value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetFloatSlice(name string) ([]float64, error) {
+	return s.config.GetFloatSlice(name)
+}
+
+// Returns the string array value of the configuration option with the given name at the time of the snapshot
+func (s ConfigSnapshot) GetStringSlice(name string) ([]string, error) {
+	return s.config.GetStringSlice(name)
+}
+
+// Returns the configuration version that this snapshot was taken at
+func (s ConfigSnapshot) Version() uint64 {
+	return s.config.version
+}
+
 //
 // Methods for internal use
 //
 
+// Returns a copy of all current configuration values, keyed by name (thread-safe)
+func (c *ServiceConfiguration) values() map[string]interface{} {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	values := make(map[string]interface{})
+	for _, name := range c.namesLocked() {
+		values[name], _ = c.valueLocked(name)
+	}
+	return values
+}
+
+// Returns the sorted names of all configuration options, regardless of their type. The caller must hold the (read) lock.
+func (c *ServiceConfiguration) namesLocked() []string {
+	names := make([]string, 0)
+	for name := range c.floatOptions {
+		names = append(names, name)
+	}
+	for name := range c.stringOptions {
+		names = append(names, name)
+	}
+	for name := range c.intOptions {
+		names = append(names, name)
+	}
+	for name := range c.boolOptions {
+		names = append(names, name)
+	}
+	for name := range c.floatSliceOptions {
+		names = append(names, name)
+	}
+	for name := range c.stringSliceOptions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns the value of the configuration option with the given name, regardless of its type. The caller must hold the (read) lock.
+func (c *ServiceConfiguration) valueLocked(name string) (interface{}, bool) {
+	if value, ok := c.floatOptions[name]; ok {
+		return value, true
+	}
+	if value, ok := c.stringOptions[name]; ok {
+		return value, true
+	}
+	if value, ok := c.intOptions[name]; ok {
+		return value, true
+	}
+	if value, ok := c.boolOptions[name]; ok {
+		return value, true
+	}
+	if value, ok := c.floatSliceOptions[name]; ok {
+		return slices.Clone(value), true
+	}
+	if value, ok := c.stringSliceOptions[name]; ok {
+		return slices.Clone(value), true
+	}
+	return nil, false
+}
+
+// Returns the type of the configuration option with the given name. The caller must hold the (read) lock.
+func (c *ServiceConfiguration) typeLocked(name string) Type {
+	if _, ok := c.floatOptions[name]; ok {
+		return Number
+	}
+	if _, ok := c.intOptions[name]; ok {
+		return Integer
+	}
+	if _, ok := c.boolOptions[name]; ok {
+		return Boolean
+	}
+	if _, ok := c.floatSliceOptions[name]; ok {
+		return NumberArray
+	}
+	if _, ok := c.stringSliceOptions[name]; ok {
+		return StringArray
+	}
+	return String
+}
+
+// Convert a decoded JSON value (float64, string, bool or []interface{}) to the Go type of the configuration option
+// with the given name. The caller must hold the (read) lock.
+func (c *ServiceConfiguration) coerceLocked(name string, value interface{}) (interface{}, error) {
+	if _, ok := c.valueLocked(name); !ok {
+		return nil, fmt.Errorf("no configuration option with name %s", name)
+	}
+
+	switch c.typeLocked(name) {
+	case Number:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+	case String:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case Integer:
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			return int64(f), nil
+		}
+	case Boolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case NumberArray:
+		if elements, ok := value.([]interface{}); ok {
+			values := make([]float64, 0, len(elements))
+			for _, e := range elements {
+				f, ok := e.(float64)
+				if !ok {
+					return nil, fmt.Errorf("cannot use %v as element of number array %s", e, name)
+				}
+				values = append(values, f)
+			}
+			return values, nil
+		}
+	case StringArray:
+		if elements, ok := value.([]interface{}); ok {
+			values := make([]string, 0, len(elements))
+			for _, e := range elements {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("cannot use %v as element of string array %s", e, name)
+				}
+				values = append(values, s)
+			}
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %v as value of %s option %s", value, c.typeLocked(name), name)
+}
+
+// Parse a raw (user-provided) string to the Go type of the configuration option with the given name.
+// Strings are taken as is, other types are parsed as JSON (string arrays can also be comma-separated). The caller must hold the (read) lock.
+func (c *ServiceConfiguration) parseLocked(name string, raw string) (interface{}, error) {
+	if _, ok := c.valueLocked(name); !ok {
+		return nil, fmt.Errorf("no configuration option with name %s", name)
+	}
+
+	switch c.typeLocked(name) {
+	case String:
+		return raw, nil
+	case StringArray:
+		if !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			return strings.Split(raw, ","), nil
+		}
+	}
+	var value interface{}
+	err := json.Unmarshal([]byte(raw), &value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q as value of %s option %s: %w", raw, c.typeLocked(name), name, err)
+	}
+	return c.coerceLocked(name, value)
+}
+
+// Set the value of the configuration option with the given name, the option must be tunable and of the same type as the value.
+// The caller must hold the write lock. Returns the resulting change, or nil if nothing changed
+func (c *ServiceConfiguration) setValueLocked(name string, value interface{}) *ConfigChange {
+	return c.assignLocked(name, value, true)
+}
+
+// Same as setValueLocked, but also for options that are not tunable (used for overrides at startup)
+func (c *ServiceConfiguration) overrideValueLocked(name string, value interface{}) *ConfigChange {
+	return c.assignLocked(name, value, false)
+}
+
+func (c *ServiceConfiguration) assignLocked(name string, value interface{}, tunableOnly bool) *ConfigChange {
+	switch v := value.(type) {
+	case float64:
+		return setOptionLocked(c, c.floatOptions, name, v, func(a, b float64) bool { return a == b }, tunableOnly)
+	case string:
+		return setOptionLocked(c, c.stringOptions, name, v, func(a, b string) bool { return a == b }, tunableOnly)
+	case int64:
+		return setOptionLocked(c, c.intOptions, name, v, func(a, b int64) bool { return a == b }, tunableOnly)
+	case bool:
+		return setOptionLocked(c, c.boolOptions, name, v, func(a, b bool) bool { return a == b }, tunableOnly)
+	case []float64:
+		return setOptionLocked(c, c.floatSliceOptions, name, v, slices.Equal[[]float64], tunableOnly)
+	case []string:
+		return setOptionLocked(c, c.stringSliceOptions, name, v, slices.Equal[[]string], tunableOnly)
+	}
+	log.Debug().Str("name", name).Msgf("Attempted to set configuration option to unsupported type %T", value)
+	return nil
+}
+
+// Set a value from a tuned number, which can be carried into float and integer options
+// The caller must hold the write lock. Returns the resulting change, or nil if nothing changed
+func (c *ServiceConfiguration) setFromNumberLocked(name string, value float64) *ConfigChange {
+	if _, ok := c.intOptions[name]; ok {
+		if value != math.Trunc(value) {
+			log.Warn().Str("name", name).Float64("value", value).Msg("Rejected non-integer value for integer configuration option")
+			c.rejections++
+			return nil
+		}
+		return c.setValueLocked(name, int64(value))
+	}
+	return c.setFloatLocked(name, value)
+}
+
+// Set a value from a tuned string, which can be carried into string, boolean and (JSON encoded) array options
+// The caller must hold the write lock. Returns the resulting change, or nil if nothing changed
+func (c *ServiceConfiguration) setFromStringLocked(name string, value string) *ConfigChange {
+	if _, ok := c.boolOptions[name]; ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Warn().Str("name", name).Str("value", value).Msg("Rejected non-boolean value for boolean configuration option")
+			c.rejections++
+			return nil
+		}
+		return c.setValueLocked(name, b)
+	}
+	if _, ok := c.floatSliceOptions[name]; ok {
+		var values []float64
+		if err := json.Unmarshal([]byte(value), &values); err != nil {
+			log.Warn().Str("name", name).Str("value", value).Msg("Rejected value for float array configuration option")
+			c.rejections++
+			return nil
+		}
+		return c.setValueLocked(name, values)
+	}
+	if _, ok := c.stringSliceOptions[name]; ok {
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err != nil {
+			log.Warn().Str("name", name).Str("value", value).Msg("Rejected value for string array configuration option")
+			c.rejections++
+			return nil
+		}
+		return c.setValueLocked(name, values)
+	}
+	return c.setStringLocked(name, value)
+}
+
 // Set the float value of the configuration option with the given name (thread-safe)
 func (c *ServiceConfiguration) setFloat(name string, value float64) {
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	change := c.setFloatLocked(name, value)
+	c.lock.Unlock()
 
-	if c.tunable[name] {
-		c.floatOptions[name] = value
-		log.Debug().Str("name", name).Float64("value", value).Msg("Set float configuration option")
-	} else {
-		log.Debug().Str("name", name).Msg("Attempted to set non-tunable float configuration option")
-	}
+	c.notify(change)
+}
+
+// Set the float value of the configuration option with the given name, the caller must hold the write lock.
+// Returns the resulting change, or nil if nothing changed
+func (c *ServiceConfiguration) setFloatLocked(name string, value float64) *ConfigChange {
+	return c.setValueLocked(name, value)
 }
 
 // Set the string value of the configuration option with the given name (thread-safe)
 func (c *ServiceConfiguration) setString(name string, value string) {
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	change := c.setStringLocked(name, value)
+	c.lock.Unlock()
+
+	c.notify(change)
+}
+
+// Set the string value of the configuration option with the given name, the caller must hold the write lock.
+// Returns the resulting change, or nil if nothing changed
+func (c *ServiceConfiguration) setStringLocked(name string, value string) *ConfigChange {
+	return c.setValueLocked(name, value)
+}
+
+// Set the value of an option in the map for its type (if tunableOnly, the option must be tunable), the caller must hold the write lock.
+// Returns the resulting change, or nil if nothing changed
+func setOptionLocked[T any](c *ServiceConfiguration, options map[string]T, name string, value T, equal func(a, b T) bool, tunableOnly bool) *ConfigChange {
+	old, ok := options[name]
+	if !ok || (tunableOnly && !c.tunable[name]) {
+		log.Debug().Str("name", name).Msgf("Attempted to set non-tunable %T configuration option", value)
+		return nil
+	}
+	if !c.acceptLocked(name, value) {
+		return nil
+	}
 
-	if c.tunable[name] {
-		c.stringOptions[name] = value
-		log.Debug().Str("name", name).Str("value", value).Msg("Set string configuration option")
-	} else {
-		log.Debug().Str("name", name).Msg("Attempted to set non-tunable string configuration option")
+	options[name] = value
+	c.updateBindingsLocked(name)
+	c.updateHandlesLocked(name)
+	log.Debug().Str("name", name).Interface("value", value).Msgf("Set %T configuration option", value)
+	if equal(old, value) {
+		return nil
 	}
+	return &ConfigChange{Name: name, Old: old, New: value, Version: c.version, Timestamp: time.Now()}
 }
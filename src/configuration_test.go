@@ -6,7 +6,10 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
+
 	//roverlib "github.com/VU-ASE/roverlib-go/src"
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/tuning"
 )
 
 // helper: make a tiny Service with 1 float (tunable), 1 string entry (not tunable)
@@ -164,3 +167,103 @@ func TestSettersUndefinedBehavior(t *testing.T) {
 		t.Fatalf("GetString after setFloat returned unexpected value: got %q, want %q", valStr, newStr)
 	}
 }
+
+// Tests that a tuning state is applied as a whole, and that a snapshot is not affected by later updates
+func TestSnapshotConsistent(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	before := cfg.Snapshot()
+
+	tuning := numberTuning(uint64(time.Now().UnixMilli())+1000, "float1", 1.5)
+	tuning.DynamicParameters = append(tuning.DynamicParameters, &rovercom.TuningState_Parameter{
+		Parameter: &rovercom.TuningState_Parameter_String_{
+			String_: &rovercom.TuningState_Parameter_StringParameter{Key: "string1", Value: "manual"},
+		},
+	})
+	cfg.applyTuning(tuning)
+	after := cfg.Snapshot()
+
+	if v, _ := before.GetFloat("float1"); v != 3.14 {
+		t.Fatalf("snapshot changed after update: float1 = %v, want 3.14", v)
+	}
+	if v, _ := after.GetFloat("float1"); v != 1.5 {
+		t.Fatalf("float1 = %v, want 1.5", v)
+	}
+	if s, _ := after.GetString("string1"); s != "manual" {
+		t.Fatalf("string1 = %q, want \"manual\"", s)
+	}
+	if after.Version() != before.Version()+1 {
+		t.Fatalf("snapshot version = %d, want %d", after.Version(), before.Version()+1)
+	}
+}
+
+// Tests that integer, boolean and array options are parsed from the bootspec and can be read with typed getters
+func TestExtendedTypesFromBootspec(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"configuration": [
+			{"name": "retries", "type": "integer", "tunable": true, "value": 3},
+			{"name": "verbose", "type": "boolean", "tunable": true, "value": false},
+			{"name": "gains", "type": "number-array", "tunable": true, "value": [0.5, 1, 2]},
+			{"name": "modes", "type": "string-array", "tunable": false, "value": ["auto", "manual"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+	cfg := NewServiceConfiguration(service)
+
+	if v, err := cfg.GetInt("retries"); err != nil || v != 3 {
+		t.Fatalf("GetInt(retries) = %v, %v, want 3", v, err)
+	}
+	if v, err := cfg.GetBool("verbose"); err != nil || v {
+		t.Fatalf("GetBool(verbose) = %v, %v, want false", v, err)
+	}
+	if v, err := cfg.GetFloatSlice("gains"); err != nil || !reflect.DeepEqual(v, []float64{0.5, 1, 2}) {
+		t.Fatalf("GetFloatSlice(gains) = %v, %v, want [0.5 1 2]", v, err)
+	}
+	if v, err := cfg.GetStringSliceSafe("modes"); err != nil || !reflect.DeepEqual(v, []string{"auto", "manual"}) {
+		t.Fatalf("GetStringSlice(modes) = %v, %v, want [auto manual]", v, err)
+	}
+	if _, err := cfg.GetFloat("retries"); err == nil {
+		t.Fatalf("expected error for GetFloat on integer option")
+	}
+}
+
+// Tests that tuned numbers and strings are converted to the type of the option they are applied to
+func TestApplyTuningExtendedTypes(t *testing.T) {
+	service, _ := UnmarshalService([]byte(`{
+		"configuration": [
+			{"name": "retries", "type": "integer", "tunable": true, "value": 3},
+			{"name": "verbose", "type": "boolean", "tunable": true, "value": false},
+			{"name": "gains", "type": "number-array", "tunable": true, "value": [0.5]}
+		]
+	}`))
+	cfg := NewServiceConfiguration(service)
+	now := uint64(time.Now().UnixMilli())
+
+	tuning := numberTuning(now+1000, "retries", 5)
+	tuning.DynamicParameters = append(tuning.DynamicParameters,
+		&rovercom.TuningState_Parameter{Parameter: &rovercom.TuningState_Parameter_String_{
+			String_: &rovercom.TuningState_Parameter_StringParameter{Key: "verbose", Value: "true"},
+		}},
+		&rovercom.TuningState_Parameter{Parameter: &rovercom.TuningState_Parameter_String_{
+			String_: &rovercom.TuningState_Parameter_StringParameter{Key: "gains", Value: "[1.5, 2.5]"},
+		}},
+	)
+	cfg.applyTuning(tuning)
+
+	if v, _ := cfg.GetInt("retries"); v != 5 {
+		t.Fatalf("retries = %v, want 5", v)
+	}
+	if v, _ := cfg.GetBool("verbose"); !v {
+		t.Fatalf("verbose = %v, want true", v)
+	}
+	if v, _ := cfg.GetFloatSlice("gains"); !reflect.DeepEqual(v, []float64{1.5, 2.5}) {
+		t.Fatalf("gains = %v, want [1.5 2.5]", v)
+	}
+
+	// A fractional number cannot be applied to an integer option
+	cfg.applyTuning(numberTuning(now+2000, "retries", 5.5))
+	if v, _ := cfg.GetInt("retries"); v != 5 {
+		t.Fatalf("retries = %v, want unchanged 5", v)
+	}
+}
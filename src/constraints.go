@@ -0,0 +1,198 @@
+//
+// Validation constraints for configuration options, declared in the bootspec or registered from code.
+// Tuned values that violate the constraints of their option are rejected.
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OTA tuning values arrive as float32, so float values are compared against their constraints with float32 precision
+// (e.g. float32(0.1) widens to 0.10000000149, which should still satisfy a maximum of 0.1)
+const float32Epsilon = 1.0 / (1 << 23)
+
+// Whether two values are equal up to float32 precision
+func nearlyEqual(a float64, b float64) bool {
+	return math.Abs(a-b) <= float32Epsilon*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// The compiled form of Constraints, as checked on every update
+type constraint struct {
+	min            *float64
+	max            *float64
+	step           *float64
+	allowedFloats  []float64
+	allowedStrings []string
+	pattern        *regexp.Regexp
+}
+
+func compileConstraint(c Constraints) (*constraint, error) {
+	res := &constraint{
+		min:  c.Min,
+		max:  c.Max,
+		step: c.Step,
+	}
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return nil, fmt.Errorf("minimum %v is larger than maximum %v", *c.Min, *c.Max)
+	}
+	if c.Step != nil && *c.Step <= 0 {
+		return nil, fmt.Errorf("step %v must be positive", *c.Step)
+	}
+	for _, v := range c.Allowed {
+		if v.Double != nil {
+			res.allowedFloats = append(res.allowedFloats, *v.Double)
+		} else if v.String != nil {
+			res.allowedStrings = append(res.allowedStrings, *v.String)
+		}
+	}
+	if c.Pattern != nil {
+		// Anchor the pattern, so that it has to match the whole value
+		pattern, err := regexp.Compile("^(?:" + *c.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", *c.Pattern, err)
+		}
+		res.pattern = pattern
+	}
+	return res, nil
+}
+
+// Returns an error that describes why the float value violates the constraint, or nil if it does not
+func (c *constraint) checkFloat(value float64) error {
+	if c.min != nil && value < *c.min && !nearlyEqual(value, *c.min) {
+		return fmt.Errorf("%v is below the minimum of %v", value, *c.min)
+	}
+	if c.max != nil && value > *c.max && !nearlyEqual(value, *c.max) {
+		return fmt.Errorf("%v is above the maximum of %v", value, *c.max)
+	}
+	if c.step != nil {
+		base := 0.0
+		if c.min != nil {
+			base = *c.min
+		}
+		nearest := base + math.Round((value-base) / *c.step)**c.step
+		if !nearlyEqual(value, nearest) {
+			return fmt.Errorf("%v is not a multiple of step %v", value, *c.step)
+		}
+	}
+	if len(c.allowedFloats) > 0 {
+		for _, allowed := range c.allowedFloats {
+			if nearlyEqual(allowed, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not one of the allowed values %v", value, c.allowedFloats)
+	}
+	return nil
+}
+
+// Returns an error that describes why the string value violates the constraint, or nil if it does not
+func (c *constraint) checkString(value string) error {
+	if c.pattern != nil && !c.pattern.MatchString(value) {
+		return fmt.Errorf("%q does not match pattern %s", value, c.pattern.String())
+	}
+	if len(c.allowedStrings) > 0 {
+		for _, allowed := range c.allowedStrings {
+			if allowed == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of the allowed values %q", value, c.allowedStrings)
+	}
+	return nil
+}
+
+// Returns an error that describes why the value violates the constraint, or nil if it does not.
+// Every element of an array value must satisfy the constraint, booleans are not constrained.
+func (c *constraint) check(value interface{}) error {
+	switch v := value.(type) {
+	case float64:
+		return c.checkFloat(v)
+	case int64:
+		return c.checkFloat(float64(v))
+	case string:
+		return c.checkString(v)
+	case []float64:
+		for _, f := range v {
+			if err := c.checkFloat(f); err != nil {
+				return err
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if err := c.checkString(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Register constraints for the configuration option with the given name from code, replacing those from the bootspec.
+// Returns an error if the option does not exist, the constraints are invalid or the current value violates them.
+func (c *ServiceConfiguration) Constrain(name string, constraints Constraints) error {
+	compiled, err := compileConstraint(constraints)
+	if err != nil {
+		return fmt.Errorf("invalid constraints for configuration option %s: %w", name, err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	value, ok := c.valueLocked(name)
+	if !ok {
+		return fmt.Errorf("no configuration option with name %s", name)
+	}
+	if err := compiled.check(value); err != nil {
+		return fmt.Errorf("current value of configuration option %s violates constraints: %w", name, err)
+	}
+
+	c.constraints[name] = compiled
+	return nil
+}
+
+// Returns the amount of tuned values that were rejected because they violated the constraints of their option
+func (c *ServiceConfiguration) Rejections() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.rejections
+}
+
+// Check a new value against the constraints of its option, the caller must hold the write lock.
+// Rejections are logged and counted.
+func (c *ServiceConfiguration) acceptLocked(name string, value interface{}) bool {
+	constraint, ok := c.constraints[name]
+	if !ok {
+		return true
+	}
+
+	if err := constraint.check(value); err != nil {
+		c.rejections++
+		log.Warn().Str("name", name).Str("reason", err.Error()).Msg("Rejected configuration value")
+		return false
+	}
+	return true
+}
+
+// Returns why a tuned value cannot be assigned to the option with the given name, or nil if it can.
+// Rejections by constraints are counted, the caller must hold the write lock.
+func (c *ServiceConfiguration) checkTunedLocked(name string, value interface{}) error {
+	if !c.tunable[name] {
+		return fmt.Errorf("option is not tunable")
+	}
+	constraint, ok := c.constraints[name]
+	if !ok {
+		return nil
+	}
+	if err := constraint.check(value); err != nil {
+		c.rejections++
+		return fmt.Errorf("rejected by constraints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package roverlib
+
+import (
+	"testing"
+	"time"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+func stringPtr(v string) *string  { return &v }
+
+// Tests that out-of-range float values are rejected and counted
+func TestConstrainFloat(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	if err := cfg.Constrain("float1", Constraints{Min: floatPtr(0), Max: floatPtr(10), Step: floatPtr(0.01)}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+
+	cfg.setFloat("float1", 1000)
+	cfg.setFloat("float1", -1)
+	cfg.setFloat("float1", 1.234)
+	if v, _ := cfg.GetFloat("float1"); v != 3.14 {
+		t.Fatalf("float1 = %v, want unchanged 3.14", v)
+	}
+	if cfg.Rejections() != 3 {
+		t.Fatalf("Rejections() = %d, want 3", cfg.Rejections())
+	}
+
+	cfg.setFloat("float1", 5.25)
+	if v, _ := cfg.GetFloat("float1"); v != 5.25 {
+		t.Fatalf("float1 = %v, want 5.25", v)
+	}
+}
+
+// Tests that OTA tuning values, which arrive as float32, satisfy constraints that they match at float32 precision
+func TestConstrainTuningPrecision(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	now := uint64(time.Now().UnixMilli())
+	cfg.setFloat("float1", 0.1)
+	if err := cfg.Constrain("float1", Constraints{Min: floatPtr(0), Max: floatPtr(0.1), Step: floatPtr(0.01)}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+
+	cfg.applyTuning(numberTuning(now+1000, "float1", 0.05))
+	if v, _ := cfg.GetFloat("float1"); v != float64(float32(0.05)) {
+		t.Fatalf("float1 = %v, want 0.05", v)
+	}
+	cfg.applyTuning(numberTuning(now+2000, "float1", 0.1))
+	if v, _ := cfg.GetFloat("float1"); v != float64(float32(0.1)) {
+		t.Fatalf("float1 = %v, want 0.1", v)
+	}
+
+	if err := cfg.Constrain("float1", Constraints{Allowed: []Value{{Double: floatPtr(0.05)}, {Double: floatPtr(0.1)}}}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+	cfg.applyTuning(numberTuning(now+3000, "float1", 0.05))
+	if v, _ := cfg.GetFloat("float1"); v != float64(float32(0.05)) {
+		t.Fatalf("float1 = %v, want 0.05", v)
+	}
+
+	// Values that are really out of range are still rejected
+	cfg.applyTuning(numberTuning(now+4000, "float1", 0.11))
+	if v, _ := cfg.GetFloat("float1"); v != float64(float32(0.05)) {
+		t.Fatalf("float1 = %v, want unchanged 0.05", v)
+	}
+	if cfg.Rejections() != 1 {
+		t.Fatalf("Rejections() = %d, want 1", cfg.Rejections())
+	}
+}
+
+// Tests that string values must be allowed and match the pattern
+func TestConstrainString(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	err := cfg.Constrain("string1", Constraints{
+		Allowed: []Value{{String: stringPtr("auto")}, {String: stringPtr("manual")}, {String: stringPtr("manual2")}},
+		Pattern: stringPtr("[a-z]+"),
+	})
+	if err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+
+	cfg.setString("string1", "unknown")
+	cfg.setString("string1", "manual2") // allowed, but does not match the pattern
+	if s, _ := cfg.GetString("string1"); s != "auto" {
+		t.Fatalf("string1 = %q, want unchanged \"auto\"", s)
+	}
+	cfg.setString("string1", "manual")
+	if s, _ := cfg.GetString("string1"); s != "manual" {
+		t.Fatalf("string1 = %q, want \"manual\"", s)
+	}
+	if cfg.Rejections() != 2 {
+		t.Fatalf("Rejections() = %d, want 2", cfg.Rejections())
+	}
+}
+
+// Tests that invalid constraints, unknown options and violating current values are reported
+func TestConstrainInvalid(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+
+	if err := cfg.Constrain("float1", Constraints{Min: floatPtr(10), Max: floatPtr(0)}); err == nil {
+		t.Fatalf("expected error for minimum above maximum")
+	}
+	if err := cfg.Constrain("float1", Constraints{Max: floatPtr(1)}); err == nil {
+		t.Fatalf("expected error for current value above maximum")
+	}
+	if err := cfg.Constrain("string1", Constraints{Pattern: stringPtr("[")}); err == nil {
+		t.Fatalf("expected error for invalid pattern")
+	}
+	if err := cfg.Constrain("missing", Constraints{}); err == nil {
+		t.Fatalf("expected error for missing option")
+	}
+}
+
+// Tests that constraints declared in the bootspec are applied
+func TestConstraintsFromBootspec(t *testing.T) {
+	service := tunableService()
+	service.Configuration[0].Constraints = &Constraints{Max: floatPtr(5)}
+	cfg := NewServiceConfiguration(service)
+
+	cfg.setFloat("float1", 6)
+	if v, _ := cfg.GetFloat("float1"); v != 3.14 {
+		t.Fatalf("float1 = %v, want unchanged 3.14", v)
+	}
+}
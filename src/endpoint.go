@@ -0,0 +1,141 @@
+//
+// Optional local tuning endpoint (a small HTTP JSON API), to list and tweak configuration values without the tuning service:
+//
+//	GET  /configuration  lists all options with their type, tunability and current value
+//	POST /configuration  sets tunable options, e.g. {"values": {"speed": 1.5}} (an optional "timestamp" in unix ms orders updates)
+//
+// Values set through this endpoint go through the same tunability and constraint checks, and timestamp ordering, as OTA tuning values.
+//
+
+package roverlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A single configuration option, as listed by the endpoint
+type OptionInfo struct {
+	Name    string      `json:"name"`
+	Type    Type        `json:"type"`
+	Tunable bool        `json:"tunable"`
+	Value   interface{} `json:"value"`
+}
+
+// The body of a POST request to the endpoint
+type endpointUpdate struct {
+	Timestamp uint64                 `json:"timestamp"`
+	Values    map[string]interface{} `json:"values"`
+}
+
+// The response to a POST request to the endpoint
+type endpointResult struct {
+	Version  uint64            `json:"version"`
+	Changed  []string          `json:"changed"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// Returns all configuration options with their type, tunability and current value (thread-safe)
+func (c *ServiceConfiguration) Options() []OptionInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	options := make([]OptionInfo, 0)
+	for _, name := range c.namesLocked() {
+		value, _ := c.valueLocked(name)
+		options = append(options, OptionInfo{
+			Name:    name,
+			Type:    c.typeLocked(name),
+			Tunable: c.tunable[name],
+			Value:   value,
+		})
+	}
+	return options
+}
+
+// Apply values that were decoded from JSON as a single update, returns the result of every value.
+// The version is only bumped if a value changed.
+func (c *ServiceConfiguration) applyValues(update endpointUpdate) (endpointResult, error) {
+	c.lock.Lock()
+	// Without a timestamp, the update is ordered after all previous updates
+	if update.Timestamp == 0 {
+		update.Timestamp = max(uint64(time.Now().UnixMilli()), c.lastUpdate+1)
+	}
+	if update.Timestamp <= c.lastUpdate {
+		c.lock.Unlock()
+		return endpointResult{}, fmt.Errorf("outdated timestamp %d", update.Timestamp)
+	}
+
+	result := endpointResult{Changed: make([]string, 0), Rejected: make(map[string]string)}
+	changes := make([]*ConfigChange, 0, len(update.Values))
+	for name, raw := range update.Values {
+		value, err := c.coerceLocked(name, raw)
+		if err == nil {
+			err = c.checkTunedLocked(name, value)
+		}
+		if err != nil {
+			result.Rejected[name] = err.Error()
+			continue
+		}
+		change := c.setValueLocked(name, value)
+		if change != nil {
+			result.Changed = append(result.Changed, name)
+			changes = append(changes, change)
+		}
+	}
+	// Updates that did not change anything do not get a new version, but later updates are still ordered after them
+	if len(result.Rejected) < len(update.Values) {
+		c.lastUpdate = update.Timestamp
+	}
+	if len(changes) > 0 {
+		c.version++
+		for _, change := range changes {
+			change.Version = c.version
+		}
+	}
+	result.Version = c.version
+	c.lock.Unlock()
+
+	stamp(changes, sourceEndpoint)
+	c.notify(changes...)
+	return result, nil
+}
+
+// The HTTP handler that serves the endpoint
+func tuningHandler(config *ServiceConfiguration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(config.Options())
+		case http.MethodPost:
+			var update endpointUpdate
+			err := json.NewDecoder(r.Body).Decode(&update)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid update: %v", err), http.StatusBadRequest)
+				return
+			}
+			result, err := config.applyValues(update)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Info().Strs("changed", result.Changed).Msg("Applied values from local tuning endpoint")
+			_ = json.NewEncoder(w).Encode(result)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	return mux
+}
+
+// Serve the local tuning endpoint on the given address (e.g. localhost:8180) until the process terminates
+func serveTuningEndpoint(address string, config *ServiceConfiguration) error {
+	log.Info().Str("address", address).Msg("Serving local tuning endpoint")
+	return http.ListenAndServe(address, tuningHandler(config))
+}
@@ -0,0 +1,83 @@
+package roverlib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests that the endpoint lists all options
+func TestEndpointList(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	server := httptest.NewServer(tuningHandler(cfg))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/configuration")
+	if err != nil {
+		t.Fatalf("GET returned %v", err)
+	}
+	defer res.Body.Close()
+
+	var options []OptionInfo
+	if err := json.NewDecoder(res.Body).Decode(&options); err != nil {
+		t.Fatalf("failed to decode options: %v", err)
+	}
+	if len(options) != 2 || options[0].Name != "config1" || options[0].Type != Number || !options[0].Tunable || options[0].Value != 3.14 {
+		t.Fatalf("options = %+v, want config1 (tunable number 3.14) and config2", options)
+	}
+}
+
+// Tests that tunable options can be set, and that non-tunable options and outdated updates are rejected
+func TestEndpointUpdate(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	server := httptest.NewServer(tuningHandler(cfg))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/configuration", "application/json", strings.NewReader(`{"values": {"config1": 1.5, "config2": "manual"}}`))
+	if err != nil {
+		t.Fatalf("POST returned %v", err)
+	}
+	defer res.Body.Close()
+
+	var result endpointResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if len(result.Changed) != 1 || result.Changed[0] != "config1" || result.Rejected["config2"] == "" {
+		t.Fatalf("result = %+v, want config1 changed and config2 rejected", result)
+	}
+	if v, _ := cfg.GetFloat("config1"); v != 1.5 {
+		t.Fatalf("config1 = %v, want 1.5", v)
+	}
+
+	outdated, err := http.Post(server.URL+"/configuration", "application/json", strings.NewReader(`{"timestamp": 1, "values": {"config1": 2.5}}`))
+	if err != nil {
+		t.Fatalf("POST returned %v", err)
+	}
+	outdated.Body.Close()
+	if outdated.StatusCode != http.StatusConflict {
+		t.Fatalf("outdated update returned status %d, want %d", outdated.StatusCode, http.StatusConflict)
+	}
+}
+
+// Tests that values rejected by constraints are reported with a reason, and do not bump the version
+func TestEndpointConstrained(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	if err := cfg.Constrain("config1", Constraints{Max: floatPtr(5)}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+	version := cfg.Version()
+
+	result, err := cfg.applyValues(endpointUpdate{Values: map[string]interface{}{"config1": 50.0}})
+	if err != nil {
+		t.Fatalf("applyValues returned %v", err)
+	}
+	if len(result.Changed) != 0 || !strings.Contains(result.Rejected["config1"], "maximum") {
+		t.Fatalf("result = %+v, want config1 rejected by its maximum", result)
+	}
+	if result.Version != version || cfg.Version() != version {
+		t.Fatalf("version = %d, want %d as nothing was applied", cfg.Version(), version)
+	}
+}
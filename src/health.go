@@ -0,0 +1,68 @@
+//
+// Readiness and health reporting from the user program. Both are published in the heartbeat, so that orchestration
+// can wait for a service to be ready before starting the services that depend on it.
+//
+
+package roverlib
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+type HealthStatus string
+
+const (
+	Healthy   HealthStatus = "healthy"
+	Degraded  HealthStatus = "degraded"
+	Unhealthy HealthStatus = "unhealthy"
+)
+
+// The health as reported by the user program
+type health struct {
+	Ready  bool         `json:"ready"`
+	Status HealthStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+var currentHealth = health{Status: Healthy}
+var healthLock sync.RWMutex
+
+// Signals the heartbeat publisher that the health changed, so that it does not have to wait for the next interval
+var healthChanged = make(chan struct{}, 1)
+
+// Report that the user program is initialized and ready to do its work
+func (s *Service) SetReady() {
+	healthLock.Lock()
+	currentHealth.Ready = true
+	healthLock.Unlock()
+
+	log.Info().Msg("Service is ready")
+	notifyHealthChanged()
+}
+
+// Report the health of the user program, with a human-readable reason (e.g. "camera frames are dropped")
+func (s *Service) SetHealth(status HealthStatus, reason string) {
+	healthLock.Lock()
+	currentHealth.Status = status
+	currentHealth.Reason = reason
+	healthLock.Unlock()
+
+	log.Info().Str("status", string(status)).Str("reason", reason).Msg("Service health changed")
+	notifyHealthChanged()
+}
+
+func notifyHealthChanged() {
+	select {
+	case healthChanged <- struct{}{}:
+	default:
+		// A heartbeat is already pending
+	}
+}
+
+func getHealth() health {
+	healthLock.RLock()
+	defer healthLock.RUnlock()
+	return currentHealth
+}
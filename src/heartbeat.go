@@ -0,0 +1,118 @@
+//
+// Periodic heartbeat that is published by every service (if enabled in the bootspec), so that roverd or a monitoring tool
+// can tell a hung service (no heartbeats, or a main loop iteration count that does not increase) from an idle one
+//
+
+package roverlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/rs/zerolog/log"
+)
+
+// Used when the bootspec does not specify a heartbeat interval
+const defaultHeartbeatInterval = 1000 // ms
+
+// The moment that this service was started, used to compute the uptime
+var startedAt = time.Now()
+
+// Amount of main loop iterations reported by the user program through Tick()
+var iterations atomic.Uint64
+
+// The message that is published on the heartbeat address, encoded as JSON
+type HeartbeatMessage struct {
+	Name       string                 `json:"name"`
+	Version    string                 `json:"version"`
+	Timestamp  int64                  `json:"timestamp"` // unix ms
+	Uptime     int64                  `json:"uptime"`    // ms
+	Iterations uint64                 `json:"iterations"`
+	Ready      bool                   `json:"ready"`
+	Health     HealthStatus           `json:"health"`
+	Reason     string                 `json:"reason,omitempty"`
+	Outputs    []StreamStats          `json:"outputs"`
+	Inputs     []StreamStats          `json:"inputs"`
+	Tuning     map[string]interface{} `json:"tuning"`
+}
+
+// Report that the user program completed one iteration of its main loop.
+// The iteration count is published in the heartbeat, so that a service that is stuck can be distinguished from one that is idle.
+func (s *Service) Tick() {
+	iterations.Add(1)
+}
+
+// Build the heartbeat message that reflects the current state of the service
+func buildHeartbeat(service Service, config *ServiceConfiguration) HeartbeatMessage {
+	now := time.Now()
+	msg := HeartbeatMessage{
+		Timestamp:  now.UnixMilli(),
+		Uptime:     now.Sub(startedAt).Milliseconds(),
+		Iterations: iterations.Load(),
+		Tuning:     config.values(),
+	}
+	if service.Name != nil {
+		msg.Name = *service.Name
+	}
+	if service.Version != nil {
+		msg.Version = *service.Version
+	}
+	h := getHealth()
+	msg.Ready, msg.Health, msg.Reason = h.Ready, h.Status, h.Reason
+	msg.Outputs, msg.Inputs = collectStreamStats()
+	return msg
+}
+
+// Publish heartbeats on the address from the bootspec until the process terminates (only returns on setup errors)
+func publishHeartbeats(service Service, config *ServiceConfiguration) error {
+	if service.Heartbeat == nil || service.Heartbeat.Address == nil {
+		return fmt.Errorf("no heartbeat address specified")
+	}
+	interval := int64(defaultHeartbeatInterval)
+	if service.Heartbeat.Interval != nil && *service.Heartbeat.Interval > 0 {
+		interval = *service.Heartbeat.Interval
+	}
+
+	// ZMQ wants to bind to tcp://*:port addresses, so if roverd gave us a localhost, we need to change it to *
+	address := strings.Replace(*service.Heartbeat.Address, "localhost", "*", 1)
+	socket, err := zmq4.NewSocket(zmq4.PUB)
+	if err != nil {
+		return fmt.Errorf("Failed to create heartbeat socket at %s: %w", address, err)
+	}
+	defer socket.Close()
+	if security != nil {
+		err = security.serve(socket)
+		if err != nil {
+			return err
+		}
+	}
+	err = socket.Bind(address)
+	if err != nil {
+		return fmt.Errorf("Failed to bind heartbeat socket to %s: %w", address, err)
+	}
+
+	log.Info().Str("address", address).Int64("interval", interval).Msg("Publishing heartbeats")
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// Publish on every interval, and immediately when the user program reports a change in health
+		select {
+		case <-ticker.C:
+		case <-healthChanged:
+		}
+
+		buf, err := json.Marshal(buildHeartbeat(service, config))
+		if err != nil {
+			log.Err(err).Msg("Failed to marshal heartbeat")
+			continue
+		}
+		_, err = socket.SendBytes(buf, 0)
+		if err != nil {
+			log.Err(err).Msg("Failed to publish heartbeat")
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package roverlib
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Tests that a heartbeat carries the service identity, the iteration count and the current tuning values
+func TestBuildHeartbeat(t *testing.T) {
+	service := sampleService()
+	name, version := "controller", "1.0.1"
+	service.Name = &name
+	service.Version = &version
+	cfg := NewServiceConfiguration(service)
+
+	before := iterations.Load()
+	service.Tick()
+	service.Tick()
+
+	msg := buildHeartbeat(service, cfg)
+	if msg.Name != "controller" || msg.Version != "1.0.1" {
+		t.Fatalf("heartbeat identity = %q@%q, want controller@1.0.1", msg.Name, msg.Version)
+	}
+	if msg.Iterations != before+2 {
+		t.Fatalf("heartbeat iterations = %d, want %d", msg.Iterations, before+2)
+	}
+	if msg.Tuning["config1"] != 3.14 || msg.Tuning["config2"] != "auto" {
+		t.Fatalf("heartbeat tuning = %#v, want config1=3.14 and config2=auto", msg.Tuning)
+	}
+	if msg.Uptime < 0 {
+		t.Fatalf("heartbeat uptime = %d, want >= 0", msg.Uptime)
+	}
+
+	// Must be encodable over the wire
+	if _, err := json.Marshal(msg); err != nil {
+		t.Fatalf("failed to marshal heartbeat: %v", err)
+	}
+}
+
+// Tests that the stream statistics in the heartbeat reflect the streams that were handed out
+func TestHeartbeatStreamStats(t *testing.T) {
+	service := sampleServiceStream()
+	write := service.GetWriteStream("testOutput")
+	write.stream.messages.Add(3)
+	write.stream.bytes.Add(42)
+
+	outputs, _ := collectStreamStats()
+	for _, stats := range outputs {
+		if stats.Name == "testOutput" {
+			if stats.Messages != 3 || stats.Bytes != 42 {
+				t.Fatalf("stats = %+v, want 3 messages and 42 bytes", stats)
+			}
+			return
+		}
+	}
+	t.Fatalf("testOutput not found in stream stats %+v", outputs)
+}
+
+// Tests that readiness and health reported by the user program end up in the heartbeat
+func TestHeartbeatHealth(t *testing.T) {
+	service := sampleService()
+	cfg := NewServiceConfiguration(service)
+	defer func() {
+		healthLock.Lock()
+		currentHealth = health{Status: Healthy}
+		healthLock.Unlock()
+	}()
+
+	service.SetReady()
+	service.SetHealth(Degraded, "camera frames are dropped")
+
+	msg := buildHeartbeat(service, cfg)
+	if !msg.Ready {
+		t.Fatalf("heartbeat should report ready after SetReady")
+	}
+	if msg.Health != Degraded || msg.Reason != "camera frames are dropped" {
+		t.Fatalf("heartbeat health = %q (%q), want degraded", msg.Health, msg.Reason)
+	}
+}
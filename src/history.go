@@ -0,0 +1,74 @@
+//
+// Bounded history of applied configuration changes, so that a bad tuning push can be undone in one step
+// and the tuning timeline can be correlated with recorded sensor data
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The maximum amount of changes that is kept in the history
+const maxHistory = 256
+
+// Add a change to the history, the caller must hold the listeners lock
+func (l *listeners) record(change ConfigChange) {
+	l.history = append(l.history, change)
+	if len(l.history) > maxHistory {
+		l.history = l.history[len(l.history)-maxHistory:]
+		l.historyDropped = true
+	}
+}
+
+// Returns the applied changes (with timestamp, key, old value, new value and source), oldest first
+func (c *ServiceConfiguration) History() []ConfigChange {
+	c.listeners.lock.Lock()
+	defer c.listeners.lock.Unlock()
+
+	return append([]ConfigChange{}, c.listeners.history...)
+}
+
+// Undo all changes that were applied after the given configuration version, as a new version.
+// Returns an error if the history does not go back far enough.
+func (c *ServiceConfiguration) Rollback(toVersion uint64) error {
+	history := c.History()
+
+	// The value to restore for every option is the old value of its first change after the version
+	restore := make(map[string]interface{})
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Version > toVersion {
+			restore[history[i].Name] = history[i].Old
+		}
+	}
+
+	c.listeners.lock.Lock()
+	dropped := c.listeners.historyDropped
+	c.listeners.lock.Unlock()
+	if dropped && len(history) > 0 && history[0].Version > toVersion {
+		return fmt.Errorf("cannot roll back to version %d, the history only goes back to version %d", toVersion, history[0].Version)
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+
+	c.lock.Lock()
+	if !c.beginUpdateLocked(max(uint64(time.Now().UnixMilli()), c.lastUpdate+1)) {
+		c.lock.Unlock()
+		return fmt.Errorf("failed to start rollback")
+	}
+	changes := make([]*ConfigChange, 0, len(restore))
+	for name, value := range restore {
+		changes = append(changes, c.setValueLocked(name, value))
+	}
+	version := c.version
+	c.lock.Unlock()
+
+	log.Info().Uint64("to", toVersion).Uint64("version", version).Int("options", len(restore)).Msg("Rolled back configuration")
+	stamp(changes, sourceRollback)
+	c.notify(changes...)
+	return nil
+}
@@ -0,0 +1,52 @@
+package roverlib
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that applied changes are recorded with their source and version
+func TestHistory(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	now := uint64(time.Now().UnixMilli())
+
+	cfg.applyTuning(numberTuning(now+1000, "float1", 1.5))
+	cfg.applyTuning(numberTuning(now+2000, "float1", 2.5))
+
+	history := cfg.History()
+	if len(history) != 2 {
+		t.Fatalf("len(History()) = %d, want 2", len(history))
+	}
+	first := history[0]
+	if first.Name != "float1" || first.Old != 3.14 || first.New != 1.5 || first.Version != 1 || first.Source != "tuning" || first.Timestamp.IsZero() {
+		t.Fatalf("history[0] = %+v, want float1 3.14 -> 1.5 in version 1 from tuning", first)
+	}
+}
+
+// Tests that a rollback restores the values of a previous version as a new version
+func TestRollback(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	now := uint64(time.Now().UnixMilli())
+
+	cfg.applyTuning(numberTuning(now+1000, "float1", 1.5))
+	good := cfg.Version()
+	cfg.applyTuning(numberTuning(now+2000, "float1", 100))
+	cfg.setString("string1", "manual")
+
+	if err := cfg.Rollback(good); err != nil {
+		t.Fatalf("Rollback returned %v", err)
+	}
+	if v, _ := cfg.GetFloat("float1"); v != 1.5 {
+		t.Fatalf("float1 = %v after rollback, want 1.5", v)
+	}
+	if s, _ := cfg.GetString("string1"); s != "auto" {
+		t.Fatalf("string1 = %q after rollback, want \"auto\"", s)
+	}
+	if cfg.Version() != good+2 {
+		t.Fatalf("Version() = %d after rollback, want %d", cfg.Version(), good+2)
+	}
+	last := cfg.History()[len(cfg.History())-1]
+	if last.Source != "rollback" {
+		t.Fatalf("last change source = %q, want \"rollback\"", last.Source)
+	}
+}
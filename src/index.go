@@ -7,14 +7,12 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	build_debug "runtime/debug"
 
-	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/tuning"
-	"github.com/pebbe/zmq4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/protobuf/proto"
 )
 
 // The core exposes two endpoints: a pub/sub endpoint for broadcasting service registration and a req/rep endpoint for registering services and resolving dependencies
@@ -78,14 +76,24 @@ func setupLogging(debug bool, outputPath string, service Service) {
 
 // Start the program (main) and handle termination
 func Run(main MainCallback, onTerminate TerminationCallback) {
+	startedAt = time.Now()
+
 	// Parse args
 	defaultDebug := false
 	defaultOutput := ""
+	defaultTuningState := ""
+	defaultTuningEndpoint := ""
 	debug := &defaultDebug
 	output := &defaultOutput
+	tuningState := &defaultTuningState
+	tuningEndpoint := &defaultTuningEndpoint
+	var overrides configFlags
 	if !flag.Parsed() {
 		debug = flag.Bool("debug", defaultDebug, "show all logs (including debug)")
 		output = flag.String("output", defaultOutput, "path of the output file to log to")
+		tuningState = flag.String("tuning-state", defaultTuningState, "path of the file to persist tuned configuration values to (and reload them from on restart)")
+		flag.Var(&overrides, "config", "override a configuration option as name=value (can be repeated)")
+		tuningEndpoint = flag.String("tuning-endpoint", defaultTuningEndpoint, "address (e.g. localhost:8180) to serve a local HTTP endpoint on for listing and tuning configuration values")
 		flag.Parse()
 	}
 
@@ -117,78 +125,94 @@ func Run(main MainCallback, onTerminate TerminationCallback) {
 	if err != nil {
 		panic(fmt.Errorf("Failed to unmarshal service definition in ASE_SERVICE: %w", err))
 	}
+	err = service.Validate()
+	if err != nil {
+		panic(fmt.Errorf("Invalid service definition in ASE_SERVICE: %w", err))
+	}
+
+	// Streams are only authenticated and encrypted if enabled, but then never fall back to plain text
+	security, err = loadSecurity(service)
+	if err != nil {
+		panic(fmt.Errorf("Invalid security configuration in ASE_SERVICE: %w", err))
+	}
 
 	// Enable logging using zerolog
 	setupLogging(*debug, *output, service)
 
+	// Log provenance, and where roverd resolved something else than was declared
+	metadata, err := service.Metadata()
+	if err == nil {
+		log.Info().Str("author", metadata.Author).Str("source", metadata.Source).Str("version", metadata.Version).Msg("Starting service")
+		for _, difference := range metadata.Differences(&service) {
+			log.Warn().Msg(difference)
+		}
+	}
+
+	// Unknown fields are ignored, but might indicate that roverd is newer than this library
+	for _, field := range UnknownFields([]byte(definition)) {
+		log.Warn().Str("field", field).Str("bootspec", service.SchemaVersion()).Msg("Ignoring unknown field in service definition")
+	}
+
 	// Create a configuration for this service that will be shared with the user program
 	configuration := NewServiceConfiguration(service)
 
-	// Support ota tuning in this goroutine
-	// (the user program can fetch the latest value from the configuration)
-	if *service.Tuning.Enabled {
+	// Reapply tuned values from a previous run (opt-in)
+	if *tuningState != "" {
+		err = configuration.Persist(*tuningState)
+		if err != nil {
+			log.Err(err).Msg("Failed to enable persistence of tuned configuration values")
+		}
+	}
+
+	// Overrides from the environment and command line take precedence over the bootspec and persisted values
+	err = configuration.applyOverrides(os.LookupEnv, overrides)
+	if err != nil {
+		log.Err(err).Msg("Failed to apply configuration overrides")
+	}
+
+	// Publish heartbeats in this goroutine, so that roverd can tell a hung service from an idle one
+	if service.Heartbeat != nil && service.Heartbeat.Enabled != nil && *service.Heartbeat.Enabled {
 		go func() {
-			for {
-				log.Info().Msgf("Attempting to subscribe to OTA tuning service at %s", *service.Tuning.Address)
-				// Initialize zmq socket to retrieve OTA tuning values from the service responsible for this
-				socket, err := zmq4.NewSocket(zmq4.SUB)
-				if err != nil {
-					log.Err(err).Msg("Failed to create socket for OTA tuning")
-					continue
-				}
-				err = socket.Connect(*service.Tuning.Address)
-				if err != nil {
-					log.Err(err).Msg("Failed to connect to OTA tuning service")
-					socket.Close()
-					continue
-				}
+			err := publishHeartbeats(service, configuration)
+			if err != nil {
+				log.Err(err).Msg("Stopped publishing heartbeats")
+			}
+		}()
+	}
 
-				// Subscribe to all messages
-				err = socket.SetSubscribe("")
+	// Receive updated input resolutions in these goroutines, affected read streams reconnect on their next read
+	if service.Rewiring != nil && (service.Rewiring.Address != nil || service.Rewiring.File != nil) {
+		enableRewiring(service.Inputs)
+		if service.Rewiring.Address != nil {
+			go func() {
+				err := subscribeRewiring(*service.Rewiring.Address)
 				if err != nil {
-					log.Err(err).Msg("Failed to send subscribe message")
-					socket.Close()
-					continue
+					log.Err(err).Msg("Stopped receiving input resolutions")
 				}
+			}()
+		}
+		if service.Rewiring.File != nil {
+			interval := defaultRewiringInterval * time.Millisecond
+			if service.Rewiring.Interval != nil && *service.Rewiring.Interval > 0 {
+				interval = time.Duration(*service.Rewiring.Interval) * time.Millisecond
+			}
+			go watchRewiring(*service.Rewiring.File, interval)
+		}
+	}
 
-				for {
-					log.Info().Msg("Waiting for new tuning values")
-					// Receive new configuration, and update this in the shared configuration
-					res, err := socket.Recv(0)
-					if err != nil {
-						log.Err(err).Msg("Failed to receive tuning values")
-						continue
-					}
-					log.Info().Msg("Received new tuning values")
-
-					// Convert from over-the-wire format to Go struct, using protobuf
-					var tuning rovercom.TuningState
-					err = proto.Unmarshal([]byte(res), &tuning)
-					if err != nil {
-						log.Err(err).Msg("Failed to unmarshal tuning values")
-						continue
-					}
-
-					// Is the timestamp later than the last update?
-					if tuning.Timestamp <= configuration.lastUpdate {
-						log.Info().Msg("Received new tuning values with an outdated timestamp, ignoring...")
-						continue
-					}
-
-					// Update the configuration (setX will ignore values that are not tunable)
-					for _, p := range tuning.DynamicParameters {
-						// This is certainly not pretty, but unions are not straightforward in Go
-						if p.GetNumber() != nil {
-							log.Info().Float32("key", p.GetNumber().Value).Msg("Setting tuning value")
-							configuration.setFloat(p.GetNumber().Key, float64(p.GetNumber().Value))
-						} else if p.GetString_() != nil {
-							log.Info().Str("key", p.GetString_().Value).Msg("Setting tuning value")
-							configuration.setString(p.GetString_().Key, p.GetString_().Value)
-						} else {
-							log.Warn().Msg("Unknown tuning value type")
-						}
-					}
-				}
+	// Support ota tuning in this goroutine
+	// (the user program can fetch the latest value from the configuration)
+	if *service.Tuning.Enabled {
+		configuration.tuning = newTuningSubscriber(*service.Tuning.Address, configuration)
+		go configuration.tuning.run()
+	}
+
+	// Serve the local tuning endpoint in this goroutine (opt-in)
+	if *tuningEndpoint != "" {
+		go func() {
+			err := serveTuningEndpoint(*tuningEndpoint, configuration)
+			if err != nil {
+				log.Err(err).Msg("Stopped serving local tuning endpoint")
 			}
 		}()
 	}
@@ -0,0 +1,131 @@
+//
+// A normalised, non-pointer view of the (generated) service definition, with lookup helpers, so that the user program
+// does not have to dereference (possibly nil) pointers. Missing fields are represented by their zero value.
+// The view and lookups read the definition on every call (inputs can be rewired at runtime), so they are safe to use from
+// multiple goroutines and callers get their own copy, that they are free to modify.
+//
+
+package roverlib
+
+type ServiceInfo struct {
+	Name          string
+	Version       string
+	Inputs        []InputInfo
+	Outputs       []OutputInfo
+	Configuration []string // names of all configuration options
+	Tuning        TuningInfo
+}
+
+type InputInfo struct {
+	Service string
+	Streams []StreamInfo
+}
+
+type StreamInfo struct {
+	Name    string
+	Address string
+}
+
+type OutputInfo struct {
+	Name    string
+	Address string
+}
+
+type TuningInfo struct {
+	Enabled bool
+	Address string
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+func newInputInfo(input Input) InputInfo {
+	info := InputInfo{Service: deref(input.Service), Streams: make([]StreamInfo, 0, len(input.Streams))}
+	for _, stream := range input.Streams {
+		info.Streams = append(info.Streams, StreamInfo{Name: deref(stream.Name), Address: deref(stream.Address)})
+	}
+	return info
+}
+
+func newOutputInfo(output Output) OutputInfo {
+	return OutputInfo{Name: deref(output.Name), Address: deref(output.Address)}
+}
+
+// Returns a non-pointer view of the service definition
+func (s *Service) Info() ServiceInfo {
+	info := ServiceInfo{
+		Name:          deref(s.Name),
+		Version:       deref(s.Version),
+		Inputs:        make([]InputInfo, 0, len(s.Inputs)),
+		Outputs:       make([]OutputInfo, 0, len(s.Outputs)),
+		Configuration: s.ConfigNames(),
+		Tuning: TuningInfo{
+			Enabled: deref(s.Tuning.Enabled),
+			Address: deref(s.Tuning.Address),
+		},
+	}
+	// Inputs can be rewired at runtime
+	for _, input := range currentInputs(s.Inputs) {
+		info.Inputs = append(info.Inputs, newInputInfo(input))
+	}
+	for _, output := range s.Outputs {
+		info.Outputs = append(info.Outputs, newOutputInfo(output))
+	}
+	return info
+}
+
+// Returns the resolved input dependency on the service with the given name
+func (s *Service) Input(service string) (InputInfo, bool) {
+	for _, input := range currentInputs(s.Inputs) {
+		if deref(input.Service) == service {
+			return newInputInfo(input), true
+		}
+	}
+	return InputInfo{}, false
+}
+
+// Whether the service depends on the stream with the given name of the given service
+func (s *Service) HasInput(service string, stream string) bool {
+	input, ok := s.Input(service)
+	if !ok {
+		return false
+	}
+	for _, st := range input.Streams {
+		if st.Name == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the output with the given name
+func (s *Service) Output(name string) (OutputInfo, bool) {
+	for _, output := range s.Outputs {
+		if deref(output.Name) == name {
+			return newOutputInfo(output), true
+		}
+	}
+	return OutputInfo{}, false
+}
+
+// Whether the service declares an output with the given name
+func (s *Service) HasOutput(name string) bool {
+	_, ok := s.Output(name)
+	return ok
+}
+
+// Returns the names of all configuration options, in the order of the service definition
+func (s *Service) ConfigNames() []string {
+	names := make([]string, 0, len(s.Configuration))
+	for _, c := range s.Configuration {
+		if c.Name != nil {
+			names = append(names, *c.Name)
+		}
+	}
+	return names
+}
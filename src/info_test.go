@@ -0,0 +1,60 @@
+package roverlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests the non-pointer view and lookup helpers of a parsed service definition
+func TestServiceInfo(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "controller", "version": "1.0.1",
+		"inputs": [{"service": "imaging", "streams": [{"name": "track-data", "address": "tcp://localhost:7890"}]}],
+		"outputs": [{"name": "motor-movement", "address": "tcp://*:7882"}],
+		"configuration": [{"name": "speed", "type": "number", "value": 1.5}, {"name": "mode", "type": "string", "value": "auto"}],
+		"tuning": {"enabled": false}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	info := service.Info()
+	if info.Name != "controller" || info.Version != "1.0.1" || info.Tuning.Enabled {
+		t.Fatalf("info = %+v, want controller@1.0.1 without tuning", info)
+	}
+	if input, ok := service.Input("imaging"); !ok || input.Streams[0].Address != "tcp://localhost:7890" {
+		t.Fatalf("Input(imaging) = %+v, %v", input, ok)
+	}
+	if !service.HasInput("imaging", "track-data") || service.HasInput("imaging", "missing") {
+		t.Fatalf("HasInput returned unexpected results")
+	}
+	if !service.HasOutput("motor-movement") || service.HasOutput("missing") {
+		t.Fatalf("HasOutput returned unexpected results")
+	}
+	if names := service.ConfigNames(); !reflect.DeepEqual(names, []string{"speed", "mode"}) {
+		t.Fatalf("ConfigNames() = %v, want [speed mode]", names)
+	}
+
+	// Callers get their own copy
+	info.Inputs[0].Streams[0].Address = "tcp://localhost:1"
+	info.Configuration[0] = "changed"
+	if input, _ := service.Input("imaging"); input.Streams[0].Address != "tcp://localhost:7890" {
+		t.Fatalf("modifying the result of Info() changed the service view")
+	}
+	if names := service.ConfigNames(); names[0] != "speed" {
+		t.Fatalf("modifying the result of Info() changed the configuration names")
+	}
+}
+
+// Tests that the accessors do not crash on a service with missing fields
+func TestServiceInfoMissingFields(t *testing.T) {
+	service := Service{Inputs: []Input{{Streams: []Stream{{}}}}}
+
+	info := service.Info()
+	if info.Name != "" || len(info.Inputs) != 1 || info.Inputs[0].Streams[0].Address != "" {
+		t.Fatalf("info = %+v, want zero values for missing fields", info)
+	}
+	if _, ok := service.Output("missing"); ok {
+		t.Fatalf("Output should not find a missing output")
+	}
+}
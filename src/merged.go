@@ -0,0 +1,188 @@
+//
+// Fan-in of the same stream name from multiple producer services (e.g. distance data from several sensor services),
+// every message is tagged with the service that produced it and the producers are read from in a fair, round-robin order
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
+	"github.com/pebbe/zmq4"
+	"google.golang.org/protobuf/proto"
+)
+
+// Map of all already handed out merged streams to the user program (to preserve singletons)
+var mergedStreams = make(map[string]*MergedReadStream)
+
+type MergedReadStream struct {
+	name string
+	// The service definition that the inputs are looked up in, when they are rewired
+	definition Service
+	services   []string
+	streams    []*ReadStream
+	// The index of the stream that gets priority on the next read, so that a busy producer cannot starve the others
+	next int
+}
+
+// Get a stream that reads the stream with the given name from every input that offers it. Inputs that are not resolved
+// (yet) are skipped on every read until they are, so producers that roverd resolves later join the merge.
+// Returns an error wrapping ErrStreamNotFound if no input offers the stream.
+func (s *Service) GetMergedReadStream(streamName string) (*MergedReadStream, error) {
+	streamsLock.Lock()
+	stream, ok := mergedStreams[streamName]
+	streamsLock.Unlock()
+	if ok {
+		return stream, nil
+	}
+
+	res := &MergedReadStream{name: streamName, definition: *s}
+	err := res.refresh()
+	if err != nil {
+		return nil, err
+	}
+	if len(res.streams) == 0 {
+		return nil, fmt.Errorf("%w: no input offers stream %s", ErrStreamNotFound, streamName)
+	}
+
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+	if stream, ok := mergedStreams[streamName]; ok {
+		return stream, nil
+	}
+	mergedStreams[streamName] = res
+	return res, nil
+}
+
+// Add the inputs that offer the stream, but are not part of the merge yet (e.g. because they were added by rewiring)
+func (m *MergedReadStream) refresh() error {
+	for _, input := range currentInputs(m.definition.Inputs) {
+		if input.Service == nil || slices.Contains(m.services, *input.Service) {
+			continue
+		}
+		for _, stream := range input.Streams {
+			if stream.Name == nil || *stream.Name != m.name {
+				continue
+			}
+			readStream, err := m.definition.ReadStreamE(*input.Service, m.name)
+			if err != nil {
+				return err
+			}
+			m.services = append(m.services, *input.Service)
+			m.streams = append(m.streams, readStream)
+		}
+	}
+	return nil
+}
+
+// The services that this stream reads from
+func (m *MergedReadStream) Services() []string {
+	return append([]string{}, m.services...)
+}
+
+// Returns the index of the first ready stream, starting at next and wrapping around, or -1 if none is ready
+func nextReady(ready []bool, next int) int {
+	for i := 0; i < len(ready); i++ {
+		index := (next + i) % len(ready)
+		if ready[index] {
+			return index
+		}
+	}
+	return -1
+}
+
+// Read byte data from whichever producer has data available, together with the name of the service that produced it.
+// Returns an error wrapping ErrStreamUnavailable if none of the inputs is resolved.
+func (m *MergedReadStream) ReadBytes() ([]byte, string, error) {
+	// If the inputs can be rewired or their handshakes can fail, wake up regularly to check
+	timeout := time.Duration(-1)
+	if rewiringEnabled.Load() || security != nil {
+		timeout = rewiringPollInterval
+	}
+
+	for {
+		if rewiringEnabled.Load() {
+			err := m.refresh()
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		poller := zmq4.NewPoller()
+		available := 0
+		for _, stream := range m.streams {
+			err := stream.stream.handshakeError()
+			if err != nil {
+				return nil, "", err
+			}
+			err = stream.reconnect()
+			if err != nil {
+				return nil, "", err
+			}
+			// Inputs that are not resolved (yet, or anymore) are skipped in this round
+			if stream.stream.address == "" {
+				continue
+			}
+			if stream.stream.socket == nil {
+				err := stream.init()
+				if err != nil {
+					return nil, "", err
+				}
+			}
+			poller.Add(stream.stream.socket, zmq4.POLLIN)
+			available++
+		}
+		if available == 0 {
+			return nil, "", fmt.Errorf("%w: no input of merged stream %s is resolved", ErrStreamUnavailable, m.name)
+		}
+
+		polled, err := poller.Poll(timeout)
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to wait for data on merged stream %s: %w", m.name, err)
+		}
+
+		ready := make([]bool, len(m.streams))
+		for _, p := range polled {
+			for i, stream := range m.streams {
+				if stream.stream.socket != nil && p.Socket == stream.stream.socket {
+					ready[i] = true
+				}
+			}
+		}
+		index := nextReady(ready, m.next)
+		if index < 0 {
+			continue
+		}
+
+		m.next = (index + 1) % len(m.streams)
+		data, err := m.streams[index].ReadBytes()
+		return data, m.services[index], err
+	}
+}
+
+// Read a rovercom sensor output message from whichever producer has data available, together with the name of the service that produced it
+func (m *MergedReadStream) Read() (*rovercom.SensorOutput, string, error) {
+	buf, service, err := m.ReadBytes()
+	if err != nil {
+		return nil, service, err
+	}
+
+	output := &rovercom.SensorOutput{}
+	err = proto.Unmarshal(buf, output)
+	if err != nil {
+		return nil, service, err
+	}
+	return output, service, nil
+}
+
+// Get the amount of messages and bytes read from every producer so far
+func (m *MergedReadStream) Stats() []StreamStats {
+	stats := make([]StreamStats, 0, len(m.streams))
+	for _, stream := range m.streams {
+		stats = append(stats, stream.Stats())
+	}
+	return stats
+}
@@ -0,0 +1,75 @@
+package roverlib
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Tests that a merged stream keeps every input that offers the stream name, including the ones that are not resolved yet
+func TestGetMergedReadStream(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"inputs": [
+			{"service": "lidar", "streams": [{"name": "range", "address": "tcp://localhost:7001"}]},
+			{"service": "imaging", "streams": [{"name": "track-data", "address": "tcp://localhost:7002"}]},
+			{"service": "sonar", "streams": [{"name": "range", "address": "tcp://localhost:7003"}, {"name": "raw", "address": "tcp://localhost:7004"}]},
+			{"service": "radar", "streams": [{"name": "range"}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	merged, err := service.GetMergedReadStream("range")
+	if err != nil {
+		t.Fatalf("GetMergedReadStream returned %v", err)
+	}
+	if want := []string{"lidar", "sonar", "radar"}; !reflect.DeepEqual(merged.Services(), want) {
+		t.Fatalf("Services() = %v, want %v", merged.Services(), want)
+	}
+	if again, _ := service.GetMergedReadStream("range"); again != merged {
+		t.Fatalf("Expected GetMergedReadStream to return the same instance for the same name")
+	}
+
+	if _, err := service.GetMergedReadStream("speed"); !errors.Is(err, ErrStreamNotFound) {
+		t.Fatalf("GetMergedReadStream returned %v, want ErrStreamNotFound", err)
+	}
+}
+
+// Tests that reading fails when none of the inputs of a merged stream is resolved
+func TestMergedReadStreamUnresolved(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"inputs": [
+			{"service": "barometer", "streams": [{"name": "altitude"}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	merged, err := service.GetMergedReadStream("altitude")
+	if err != nil {
+		t.Fatalf("GetMergedReadStream returned %v", err)
+	}
+	if _, _, err := merged.ReadBytes(); !errors.Is(err, ErrStreamUnavailable) {
+		t.Fatalf("ReadBytes returned %v, want ErrStreamUnavailable", err)
+	}
+}
+
+// Tests that ready producers are picked in a fair, round-robin order
+func TestNextReady(t *testing.T) {
+	ready := []bool{true, false, true}
+	next := 0
+	var order []int
+	for i := 0; i < 4; i++ {
+		index := nextReady(ready, next)
+		order = append(order, index)
+		next = (index + 1) % len(ready)
+	}
+	if want := []int{0, 2, 0, 2}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("read order = %v, want %v", order, want)
+	}
+	if index := nextReady([]bool{false, false}, 1); index != -1 {
+		t.Fatalf("nextReady() = %d, want -1 when nothing is ready", index)
+	}
+}
@@ -0,0 +1,85 @@
+//
+// The service.yaml metadata that roverd passes along in the service definition (Service.Service), decoded into a proper struct
+// so that services can log their provenance and compare what they declared against what roverd resolved
+//
+
+package roverlib
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type ServiceMetadata struct {
+	Name        string `json:"name"`
+	Author      string `json:"author"`
+	Source      string `json:"source"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	// The declared dependencies, by service name
+	Inputs []MetadataInput `json:"inputs"`
+	// The names of the declared outputs
+	Outputs []string `json:"outputs"`
+	// The declared configuration options, with their default values
+	Configuration []Configuration `json:"configuration"`
+}
+
+type MetadataInput struct {
+	Service string   `json:"service"`
+	Streams []string `json:"streams"`
+}
+
+// Returns the decoded service.yaml metadata, or an error if roverd did not pass it along or it cannot be decoded
+func (s *Service) Metadata() (ServiceMetadata, error) {
+	var metadata ServiceMetadata
+	if s.Service == nil {
+		return metadata, fmt.Errorf("no service.yaml metadata in service definition")
+	}
+
+	// The metadata was decoded as an untyped value, so convert it back and forth
+	buf, err := json.Marshal(s.Service)
+	if err != nil {
+		return metadata, fmt.Errorf("failed to encode service.yaml metadata: %w", err)
+	}
+	err = json.Unmarshal(buf, &metadata)
+	if err != nil {
+		return metadata, fmt.Errorf("failed to decode service.yaml metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// Returns the differences between what the service declared and what roverd resolved in the service definition
+func (m ServiceMetadata) Differences(s *Service) []string {
+	var differences []string
+	info := s.Info()
+
+	if m.Name != "" && m.Name != info.Name {
+		differences = append(differences, fmt.Sprintf("declared name %q, resolved as %q", m.Name, info.Name))
+	}
+	if m.Version != "" && m.Version != info.Version {
+		differences = append(differences, fmt.Sprintf("declared version %s, resolved as %s", m.Version, info.Version))
+	}
+	for _, input := range m.Inputs {
+		for _, stream := range input.Streams {
+			if !s.HasInput(input.Service, stream) {
+				differences = append(differences, fmt.Sprintf("declared input %s-%s is not resolved", input.Service, stream))
+			}
+		}
+	}
+	for _, output := range m.Outputs {
+		if !s.HasOutput(output) {
+			differences = append(differences, fmt.Sprintf("declared output %s is not resolved", output))
+		}
+	}
+
+	resolved := make(map[string]bool)
+	for _, name := range info.Configuration {
+		resolved[name] = true
+	}
+	for _, c := range m.Configuration {
+		if c.Name != nil && !resolved[*c.Name] {
+			differences = append(differences, fmt.Sprintf("declared configuration option %s is not resolved", *c.Name))
+		}
+	}
+	return differences
+}
@@ -0,0 +1,51 @@
+package roverlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that the service.yaml metadata is decoded and compared against the resolved definition
+func TestMetadata(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "controller", "version": "1.0.1",
+		"inputs": [{"service": "imaging", "streams": [{"name": "track-data", "address": "tcp://localhost:7890"}]}],
+		"outputs": [{"name": "motor-movement", "address": "tcp://*:7882"}],
+		"configuration": [{"name": "speed", "type": "number", "value": 1.5}],
+		"tuning": {"enabled": false},
+		"service": {
+			"name": "controller", "author": "vu-ase", "source": "github.com/vu-ase/controller", "version": "1.0.1",
+			"description": "Steers the rover",
+			"inputs": [{"service": "imaging", "streams": ["track-data", "debug-info"]}],
+			"outputs": ["motor-movement"],
+			"configuration": [{"name": "speed", "type": "number", "value": 0.5, "tunable": true}]
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	metadata, err := service.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata returned %v", err)
+	}
+	if metadata.Author != "vu-ase" || metadata.Source != "github.com/vu-ase/controller" || metadata.Description != "Steers the rover" {
+		t.Fatalf("metadata = %+v, want author, source and description", metadata)
+	}
+	if len(metadata.Configuration) != 1 || *metadata.Configuration[0].Value.Double != 0.5 {
+		t.Fatalf("metadata configuration = %+v, want speed = 0.5", metadata.Configuration)
+	}
+
+	want := []string{"declared input imaging-debug-info is not resolved"}
+	if differences := metadata.Differences(&service); !reflect.DeepEqual(differences, want) {
+		t.Fatalf("Differences() = %v, want %v", differences, want)
+	}
+}
+
+// Tests that a missing metadata object is reported
+func TestMetadataMissing(t *testing.T) {
+	service, _ := UnmarshalService([]byte(`{"name": "controller"}`))
+	if _, err := service.Metadata(); err == nil {
+		t.Fatalf("expected error for missing metadata")
+	}
+}
@@ -0,0 +1,108 @@
+//
+// Typed configuration handles, resolved and type-checked once at startup. Reading a handle is lock-free and always
+// returns the latest (tuned) value, so the user program does not have to choose between the unsafe and safe getters, e.g.
+//
+//	speed, err := roverlib.Float(config, "speed")
+//	...
+//	throttle := speed.Get()
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The Go types that configuration options can have
+type optionValue interface {
+	float64 | string | int64 | bool | []float64 | []string
+}
+
+// A handle to a single configuration option of type T
+type Option[T optionValue] struct {
+	name  string
+	value atomic.Pointer[T]
+}
+
+// Resolve the configuration option with the given name, e.g. NewOption[float64](config, "speed").
+// Returns an error if the option does not exist or is not of type T.
+func NewOption[T optionValue](config *ServiceConfiguration, name string) (*Option[T], error) {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	value, ok := config.valueLocked(name)
+	if !ok {
+		return nil, fmt.Errorf("no configuration option with name %s", name)
+	}
+	typed, ok := value.(T)
+	if !ok {
+		var want T
+		return nil, fmt.Errorf("configuration option %s is of type %T, not %T", name, value, want)
+	}
+
+	option := &Option[T]{name: name}
+	option.value.Store(&typed)
+	config.handles[name] = append(config.handles[name], func(value interface{}) {
+		if typed, ok := value.(T); ok {
+			option.value.Store(&typed)
+		}
+	})
+	return option, nil
+}
+
+// Resolve the number configuration option with the given name
+func Float(config *ServiceConfiguration, name string) (*Option[float64], error) {
+	return NewOption[float64](config, name)
+}
+
+// Resolve the string configuration option with the given name
+// (not named String, because that is the name of the string option Type)
+func StringOption(config *ServiceConfiguration, name string) (*Option[string], error) {
+	return NewOption[string](config, name)
+}
+
+// Resolve the integer configuration option with the given name
+func Int(config *ServiceConfiguration, name string) (*Option[int64], error) {
+	return NewOption[int64](config, name)
+}
+
+// Resolve the boolean configuration option with the given name
+func Bool(config *ServiceConfiguration, name string) (*Option[bool], error) {
+	return NewOption[bool](config, name)
+}
+
+// Resolve the number-array configuration option with the given name
+func FloatSlice(config *ServiceConfiguration, name string) (*Option[[]float64], error) {
+	return NewOption[[]float64](config, name)
+}
+
+// Resolve the string-array configuration option with the given name
+func StringSlice(config *ServiceConfiguration, name string) (*Option[[]string], error) {
+	return NewOption[[]string](config, name)
+}
+
+// Returns the latest value of the option (thread-safe and lock-free).
+// Array values are shared between callers and must not be modified.
+func (o *Option[T]) Get() T {
+	return *o.value.Load()
+}
+
+// Returns the name of the option
+func (o *Option[T]) Name() string {
+	return o.name
+}
+
+// Update all handles with the current value of an option, the caller must hold the write lock
+func (c *ServiceConfiguration) updateHandlesLocked(name string) {
+	if len(c.handles[name]) == 0 {
+		return
+	}
+	value, ok := c.valueLocked(name)
+	if !ok {
+		return
+	}
+	for _, update := range c.handles[name] {
+		update(value)
+	}
+}
@@ -0,0 +1,100 @@
+package roverlib
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests that a handle is type-checked once and follows tuning updates
+func TestOption(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+
+	speed, err := NewOption[float64](cfg, "float1")
+	if err != nil {
+		t.Fatalf("NewOption returned %v", err)
+	}
+	if speed.Get() != 3.14 || speed.Name() != "float1" {
+		t.Fatalf("%s = %v, want 3.14", speed.Name(), speed.Get())
+	}
+
+	cfg.applyTuning(numberTuning(uint64(time.Now().UnixMilli())+1000, "float1", 1.5))
+	if speed.Get() != 1.5 {
+		t.Fatalf("float1 = %v after tuning, want 1.5", speed.Get())
+	}
+
+	if _, err := NewOption[string](cfg, "float1"); err == nil {
+		t.Fatalf("expected error for option of the wrong type")
+	}
+	if _, err := NewOption[float64](cfg, "missing"); err == nil {
+		t.Fatalf("expected error for missing option")
+	}
+}
+
+// Tests that handles can be read while tuning values are applied
+func TestOptionConcurrent(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	speed, _ := NewOption[float64](cfg, "float1")
+	now := uint64(time.Now().UnixMilli())
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = speed.Get()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		cfg.applyTuning(numberTuning(now+uint64(i)+1000, "float1", float32(i)))
+	}
+	wg.Wait()
+}
+
+// Tests that the typed constructors resolve options of their type only
+func TestTypedOptions(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{"configuration": [
+		{"name": "speed", "type": "number", "value": 1.5},
+		{"name": "mode", "type": "string", "value": "auto"},
+		{"name": "retries", "type": "integer", "value": 3},
+		{"name": "verbose", "type": "boolean", "value": true},
+		{"name": "gains", "type": "number-array", "value": [1, 2]},
+		{"name": "labels", "type": "string-array", "value": ["a"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+	cfg := NewServiceConfiguration(service)
+
+	speed, err := Float(cfg, "speed")
+	if err != nil || speed.Get() != 1.5 {
+		t.Fatalf("Float(speed) = %v, %v", speed, err)
+	}
+	mode, err := StringOption(cfg, "mode")
+	if err != nil || mode.Get() != "auto" {
+		t.Fatalf("StringOption(mode) = %v, %v", mode, err)
+	}
+	retries, err := Int(cfg, "retries")
+	if err != nil || retries.Get() != 3 {
+		t.Fatalf("Int(retries) = %v, %v", retries, err)
+	}
+	verbose, err := Bool(cfg, "verbose")
+	if err != nil || !verbose.Get() {
+		t.Fatalf("Bool(verbose) = %v, %v", verbose, err)
+	}
+	if gains, err := FloatSlice(cfg, "gains"); err != nil || len(gains.Get()) != 2 {
+		t.Fatalf("FloatSlice(gains) = %v, %v", gains, err)
+	}
+	if labels, err := StringSlice(cfg, "labels"); err != nil || len(labels.Get()) != 1 {
+		t.Fatalf("StringSlice(labels) = %v, %v", labels, err)
+	}
+
+	if _, err := Int(cfg, "speed"); err == nil {
+		t.Fatalf("expected error for a number option resolved as an integer")
+	}
+	if _, err := Bool(cfg, "mode"); err == nil {
+		t.Fatalf("expected error for a string option resolved as a boolean")
+	}
+}
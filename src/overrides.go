@@ -0,0 +1,93 @@
+//
+// Overrides of configuration options from environment variables (ASE_CONFIG_<NAME>) and command line flags (-config name=value),
+// so that a single parameter can be changed on the rover without redeploying. Overrides also apply to options that are not tunable.
+//
+// Precedence (lowest to highest): bootspec, persisted tuning state, environment variables, command line flags, OTA tuning.
+//
+
+package roverlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const configEnvPrefix = "ASE_CONFIG_"
+
+// Values of the repeatable -config flag
+type configFlags []string
+
+func (f *configFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *configFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Returns the environment variable that overrides the configuration option with the given name (e.g. max-iterations becomes ASE_CONFIG_MAX_ITERATIONS)
+func configEnvName(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Apply overrides from environment variables (looked up with lookupEnv) and then from -config flags (in name=value form).
+// Invalid overrides and overrides that violate the constraints of their option are skipped and reported together.
+// Applied overrides bump the configuration version and are recorded and notified like any other change, but not persisted.
+func (c *ServiceConfiguration) applyOverrides(lookupEnv func(string) (string, bool), flags []string) error {
+	c.lock.Lock()
+
+	var errs []error
+	var changes []*ConfigChange
+	override := func(name string, raw string, source string) {
+		value, err := c.parseLocked(name, raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+			return
+		}
+		if constraint, ok := c.constraints[name]; ok {
+			if err := constraint.check(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: rejected by constraints: %w", source, err))
+				return
+			}
+		}
+
+		change := c.overrideValueLocked(name, value)
+		if change == nil {
+			log.Debug().Str("name", name).Str("value", raw).Str("source", source).Msg("Configuration option already has the overridden value")
+			return
+		}
+		log.Info().Str("name", name).Str("value", raw).Str("source", source).Msg("Overrode configuration option")
+		changes = append(changes, change)
+	}
+
+	for _, name := range c.namesLocked() {
+		if raw, ok := lookupEnv(configEnvName(name)); ok {
+			override(name, raw, configEnvName(name))
+		}
+	}
+	for _, f := range flags {
+		name, raw, ok := strings.Cut(f, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("-config %s: expected name=value", f))
+			continue
+		}
+		override(name, raw, "-config "+name)
+	}
+
+	// All overrides are applied in a single version, like a tuning state
+	if len(changes) > 0 {
+		c.version++
+		for _, change := range changes {
+			change.Version = c.version
+		}
+	}
+	c.lock.Unlock()
+
+	stamp(changes, sourceOverride)
+	c.notify(changes...)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+package roverlib
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests that environment variables and flags override options (also non-tunable ones), with flags taking precedence
+func TestApplyOverrides(t *testing.T) {
+	service, _ := UnmarshalService([]byte(`{
+		"configuration": [
+			{"name": "max-iterations", "type": "integer", "tunable": false, "value": 100},
+			{"name": "speed", "type": "number", "tunable": false, "value": 1.5},
+			{"name": "modes", "type": "string-array", "tunable": false, "value": ["auto"]}
+		]
+	}`))
+	cfg := NewServiceConfiguration(service)
+	t.Setenv("ASE_CONFIG_MAX_ITERATIONS", "200")
+	t.Setenv("ASE_CONFIG_SPEED", "2.5")
+	t.Setenv("ASE_CONFIG_MODES", "auto,manual")
+
+	err := cfg.applyOverrides(os.LookupEnv, []string{"speed=3"})
+	if err != nil {
+		t.Fatalf("applyOverrides returned %v", err)
+	}
+
+	if v, _ := cfg.GetInt("max-iterations"); v != 200 {
+		t.Fatalf("max-iterations = %v, want 200", v)
+	}
+	if v, _ := cfg.GetFloat("speed"); v != 3 {
+		t.Fatalf("speed = %v, want 3 (flag takes precedence over environment)", v)
+	}
+	if v, _ := cfg.GetStringSlice("modes"); !reflect.DeepEqual(v, []string{"auto", "manual"}) {
+		t.Fatalf("modes = %v, want [auto manual]", v)
+	}
+}
+
+// Tests that invalid overrides are reported, without stopping valid ones
+func TestApplyOverridesInvalid(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	noEnv := func(string) (string, bool) { return "", false }
+
+	err := cfg.applyOverrides(noEnv, []string{"config1=fast", "missing=1", "config2", "config2=manual"})
+	if err == nil {
+		t.Fatalf("expected errors for invalid overrides")
+	}
+	if s, _ := cfg.GetString("config2"); s != "manual" {
+		t.Fatalf("config2 = %q, want \"manual\"", s)
+	}
+}
+
+// Tests that overrides that violate constraints are reported, and that applied overrides are notified and recorded
+func TestApplyOverridesConstrained(t *testing.T) {
+	cfg := NewServiceConfiguration(tunableService())
+	if err := cfg.Constrain("float1", Constraints{Min: floatPtr(0), Max: floatPtr(10)}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+	noEnv := func(string) (string, bool) { return "", false }
+
+	var notified []interface{}
+	cfg.OnChange("float1", func(old, new interface{}) {
+		notified = append(notified, new)
+	})
+
+	err := cfg.applyOverrides(noEnv, []string{"float1=100"})
+	if err == nil || !strings.Contains(err.Error(), "rejected by constraints") {
+		t.Fatalf("applyOverrides returned %v, want the constraint violation to be reported", err)
+	}
+	if v, _ := cfg.GetFloat("float1"); v != 3.14 || len(notified) != 0 || cfg.Version() != 0 {
+		t.Fatalf("float1 = %v, notified %v, version %d, want the override to be dropped", v, notified, cfg.Version())
+	}
+
+	if err := cfg.applyOverrides(noEnv, []string{"float1=5"}); err != nil {
+		t.Fatalf("applyOverrides returned %v", err)
+	}
+	if len(notified) != 1 || notified[0] != 5.0 || cfg.Version() != 1 {
+		t.Fatalf("notified %v, version %d, want a single change to 5 in version 1", notified, cfg.Version())
+	}
+	history := cfg.History()
+	if len(history) != 1 || history[0].Source != sourceOverride {
+		t.Fatalf("History() = %+v, want a single override", history)
+	}
+}
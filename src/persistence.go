@@ -0,0 +1,139 @@
+//
+// Opt-in persistence of tuned configuration values, so that a good tuning session survives a restart of the service.
+// Accepted tuning values are written to a local state file and reapplied at startup, on top of the bootspec defaults.
+//
+
+package roverlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+type persistence struct {
+	path string
+	lock sync.Mutex
+	// The tuned values that are persisted, keyed by option name
+	values map[string]interface{}
+}
+
+// The contents of the state file
+type persistedState struct {
+	Values map[string]interface{} `json:"values"`
+}
+
+// Reapply the tuned values from the state file at path (if it exists) and persist all subsequently accepted tuning values to it.
+// Persisted values go through the same tunability and constraint checks as tuning values.
+func (c *ServiceConfiguration) Persist(path string) error {
+	p := &persistence{
+		path:   path,
+		values: make(map[string]interface{}),
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read tuning state from %s: %w", path, err)
+	}
+	if err == nil {
+		var state persistedState
+		err = json.Unmarshal(buf, &state)
+		if err != nil {
+			return fmt.Errorf("failed to parse tuning state in %s: %w", path, err)
+		}
+
+		c.lock.Lock()
+		c.version++
+		changes := make([]*ConfigChange, 0, len(state.Values))
+		for name, raw := range state.Values {
+			value, err := c.coerceLocked(name, raw)
+			if err == nil {
+				err = c.checkTunedLocked(name, value)
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("name", name).Msg("Ignoring persisted tuning value")
+				continue
+			}
+			changes = append(changes, c.setValueLocked(name, value))
+			p.values[name] = value
+		}
+		c.lock.Unlock()
+
+		log.Info().Str("path", path).Int("values", len(p.values)).Msg("Reapplied persisted tuning values")
+		stamp(changes, sourcePersisted)
+		c.notify(changes...)
+
+		// Values that were ignored are dropped from the state file
+		if len(p.values) < len(state.Values) {
+			p.save(nil)
+		}
+	}
+
+	c.listeners.lock.Lock()
+	c.listeners.persistence = p
+	c.listeners.lock.Unlock()
+	return nil
+}
+
+// Record the changes and write all persisted values to the state file
+func (p *persistence) save(changes []*ConfigChange) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, change := range changes {
+		if change != nil {
+			p.values[change.Name] = change.New
+		}
+	}
+	buf, err := json.MarshalIndent(persistedState{Values: p.values}, "", "  ")
+	if err != nil {
+		log.Err(err).Msg("Failed to marshal tuning state")
+		return
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a half-written state file behind
+	tmp := filepath.Join(filepath.Dir(p.path), "."+filepath.Base(p.path)+".tmp")
+	err = os.WriteFile(tmp, buf, 0664)
+	if err == nil {
+		err = os.Rename(tmp, p.path)
+	}
+	if err != nil {
+		log.Err(err).Str("path", p.path).Msg("Failed to persist tuning state")
+	}
+}
+
+// Write the current configuration as a service.yaml configuration snippet, so that tuned values can be committed
+func (c *ServiceConfiguration) ExportYAML(w io.Writer) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	_, err := fmt.Fprintln(w, "configuration:")
+	if err != nil {
+		return err
+	}
+	for _, name := range c.namesLocked() {
+		value, _ := c.valueLocked(name)
+		// JSON scalars and arrays are valid YAML flow values
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "  - name: %s\n    type: %s\n    value: %s\n", name, c.typeLocked(name), encoded)
+		if err != nil {
+			return err
+		}
+		if c.tunable[name] {
+			_, err = fmt.Fprintln(w, "    tunable: true")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
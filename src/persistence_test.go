@@ -0,0 +1,87 @@
+package roverlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that tuned values are written to the state file and reapplied by a new configuration
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tuning.json")
+
+	cfg := NewServiceConfiguration(tunableService())
+	if err := cfg.Persist(path); err != nil {
+		t.Fatalf("Persist returned %v", err)
+	}
+	cfg.applyTuning(numberTuning(uint64(time.Now().UnixMilli())+1000, "float1", 1.5))
+
+	// Simulate a restart
+	restarted := NewServiceConfiguration(tunableService())
+	if err := restarted.Persist(path); err != nil {
+		t.Fatalf("Persist returned %v", err)
+	}
+	if v, _ := restarted.GetFloat("float1"); v != 1.5 {
+		t.Fatalf("float1 = %v after restart, want 1.5", v)
+	}
+	if s, _ := restarted.GetString("string1"); s != "auto" {
+		t.Fatalf("string1 = %q after restart, want bootspec default \"auto\"", s)
+	}
+}
+
+// Tests that persisted values that are rejected are not applied, and are dropped from the state file
+func TestPersistRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tuning.json")
+	state := `{"values": {"float1": 50, "config2": "manual", "string1": "manual"}}`
+	if err := os.WriteFile(path, []byte(state), 0664); err != nil {
+		t.Fatalf("WriteFile returned %v", err)
+	}
+
+	service := tunableService()
+	service.Configuration = append(service.Configuration, sampleService().Configuration[1])
+	cfg := NewServiceConfiguration(service)
+	if err := cfg.Constrain("float1", Constraints{Max: floatPtr(5)}); err != nil {
+		t.Fatalf("Constrain returned %v", err)
+	}
+	if err := cfg.Persist(path); err != nil {
+		t.Fatalf("Persist returned %v", err)
+	}
+	if v, _ := cfg.GetFloat("float1"); v != 3.14 {
+		t.Fatalf("float1 = %v, want the persisted value over its max to be rejected", v)
+	}
+	if s, _ := cfg.GetString("string1"); s != "manual" {
+		t.Fatalf("string1 = %q, want the persisted value \"manual\"", s)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returned %v", err)
+	}
+	if strings.Contains(string(buf), "float1") || strings.Contains(string(buf), "config2") || !strings.Contains(string(buf), "string1") {
+		t.Fatalf("state file = %s, want only string1 to be kept", buf)
+	}
+}
+
+// Tests that the configuration can be exported as a service.yaml snippet
+func TestExportYAML(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	var out strings.Builder
+	if err := cfg.ExportYAML(&out); err != nil {
+		t.Fatalf("ExportYAML returned %v", err)
+	}
+
+	want := `configuration:
+  - name: config1
+    type: number
+    value: 3.14
+    tunable: true
+  - name: config2
+    type: string
+    value: "auto"
+`
+	if out.String() != want {
+		t.Fatalf("ExportYAML =\n%s\nwant\n%s", out.String(), want)
+	}
+}
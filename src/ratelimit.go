@@ -0,0 +1,103 @@
+//
+// Rate limiting (token bucket) and decimation (keeping only every Nth message) for write streams, so that chatty outputs
+// such as debug streams do not saturate the CPU or network of the rover. Suppressed messages are counted in the stream stats.
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A token bucket that allows rate messages per second on average, with bursts of up to burst messages
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, now time.Time) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// Whether a message can be sent at the given time, takes a token if so
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// The limits that apply to a write stream
+type writeLimits struct {
+	lock    sync.Mutex
+	limiter *rateLimiter // nil if the rate is not limited
+	every   uint64       // keep every Nth message, 0 or 1 to keep all
+	offered uint64       // amount of messages offered for writing so far, used for decimation
+}
+
+// Limit the stream to at most rate messages per second on average, allowing bursts of up to burst messages.
+// Messages over the limit are dropped (and counted as suppressed) instead of written. A rate of 0 removes the limit.
+func (s *WriteStream) SetMaxRate(rate float64, burst int) error {
+	if rate < 0 {
+		return fmt.Errorf("Maximum rate %v must not be negative", rate)
+	}
+	if rate > 0 && burst < 1 {
+		return fmt.Errorf("Burst %d must be at least 1", burst)
+	}
+
+	s.limits.lock.Lock()
+	defer s.limits.lock.Unlock()
+
+	s.limits.limiter = nil
+	if rate > 0 {
+		s.limits.limiter = newRateLimiter(rate, burst, time.Now())
+	}
+	return nil
+}
+
+// Keep only every Nth message written to the stream, starting with the first. The others are dropped (and counted as suppressed).
+// A value of 1 keeps all messages.
+func (s *WriteStream) SetDecimation(every int) error {
+	if every < 1 {
+		return fmt.Errorf("Decimation %d must be at least 1", every)
+	}
+
+	s.limits.lock.Lock()
+	defer s.limits.lock.Unlock()
+
+	s.limits.every = uint64(every)
+	s.limits.offered = 0
+	return nil
+}
+
+// Whether the next message can be written, or is suppressed by decimation or the rate limit
+func (s *WriteStream) admit(now time.Time) bool {
+	s.limits.lock.Lock()
+	defer s.limits.lock.Unlock()
+
+	offered := s.limits.offered
+	s.limits.offered++
+	if s.limits.every > 1 && offered%s.limits.every != 0 {
+		return false
+	}
+	if s.limits.limiter != nil && !s.limits.limiter.allow(now) {
+		return false
+	}
+	return true
+}
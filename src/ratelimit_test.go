@@ -0,0 +1,83 @@
+package roverlib
+
+import (
+	"testing"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
+)
+
+// Tests that the token bucket allows bursts and refills at the configured rate
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(10, 2, now)
+
+	if !limiter.allow(now) || !limiter.allow(now) {
+		t.Fatalf("Expected a burst of two messages to be allowed")
+	}
+	if limiter.allow(now) {
+		t.Fatalf("Expected the third message of the burst to be suppressed")
+	}
+	if limiter.allow(now.Add(50 * time.Millisecond)) {
+		t.Fatalf("Expected no token to be available after half the refill interval")
+	}
+	if !limiter.allow(now.Add(100 * time.Millisecond)) {
+		t.Fatalf("Expected a token to be available after the refill interval")
+	}
+	// The bucket does not fill beyond the burst size
+	later := now.Add(time.Hour)
+	if !limiter.allow(later) || !limiter.allow(later) || limiter.allow(later) {
+		t.Fatalf("Expected the bucket to hold at most two tokens")
+	}
+}
+
+// Tests that decimation keeps every Nth message, starting with the first
+func TestDecimation(t *testing.T) {
+	stream := &WriteStream{}
+	if err := stream.SetDecimation(3); err != nil {
+		t.Fatalf("SetDecimation returned %v", err)
+	}
+
+	var kept []int
+	for i := 0; i < 7; i++ {
+		if stream.admit(time.Now()) {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) != 3 || kept[0] != 0 || kept[1] != 3 || kept[2] != 6 {
+		t.Fatalf("kept messages %v, want [0 3 6]", kept)
+	}
+}
+
+// Tests that decimated messages are dropped before they are marshalled or sent
+func TestWriteDecimated(t *testing.T) {
+	stream := &WriteStream{}
+	if err := stream.SetDecimation(2); err != nil {
+		t.Fatalf("SetDecimation returned %v", err)
+	}
+	// The first message is kept, so it reaches the (unbound) socket
+	_ = stream.Write(&rovercom.SensorOutput{})
+	if err := stream.Write(&rovercom.SensorOutput{}); err != nil {
+		t.Fatalf("Write returned %v for a decimated message, want it to be dropped without error", err)
+	}
+	if stats := stream.Stats(); stats.Suppressed != 1 {
+		t.Fatalf("Suppressed = %d, want 1", stats.Suppressed)
+	}
+}
+
+// Tests that invalid limits are rejected
+func TestWriteLimitsInvalid(t *testing.T) {
+	stream := &WriteStream{}
+	if err := stream.SetMaxRate(-1, 1); err == nil {
+		t.Fatalf("expected error for a negative rate")
+	}
+	if err := stream.SetMaxRate(10, 0); err == nil {
+		t.Fatalf("expected error for an empty burst")
+	}
+	if err := stream.SetDecimation(0); err == nil {
+		t.Fatalf("expected error for decimation 0")
+	}
+	if err := stream.SetMaxRate(0, 0); err != nil {
+		t.Fatalf("SetMaxRate(0, 0) returned %v, want the limit to be removed", err)
+	}
+}
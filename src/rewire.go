@@ -0,0 +1,265 @@
+//
+// Dynamic rewiring of input streams: when roverd restarts a producer on a new port or swaps the implementation of a service,
+// it publishes the updated input resolutions on a control socket or writes them to a watched file. Affected read streams
+// reconnect transparently on their next read, and the user program is notified through OnRewire callbacks.
+//
+
+package roverlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/rs/zerolog/log"
+)
+
+// Used when the bootspec does not specify an interval for checking the watched file
+const defaultRewiringInterval = 1000 // ms
+
+// How long a read waits for data before checking whether its stream was rewired
+const rewiringPollInterval = 250 * time.Millisecond
+
+// A single input stream that was resolved to a different address. An empty Old address means that the stream was added,
+// an empty New address means that it was removed.
+type InputChange struct {
+	Service string `json:"service"`
+	Stream  string `json:"stream"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+// Whether input resolutions can change at runtime, in which case reads periodically check for a pending reconnect
+var rewiringEnabled atomic.Bool
+
+// An input stream as resolved by roverd
+type resolvedStream struct {
+	service string
+	stream  string
+	address string
+}
+
+// The current resolution of every input stream (by stream name) and the callbacks to notify on changes
+var resolvedInputs = make(map[string]resolvedStream)
+var rewireCallbacks []func([]InputChange)
+var rewireLock sync.Mutex
+
+// Register a callback that is called with all changed input streams whenever roverd updates the input resolutions.
+// Read streams are reconnected by the library, so the callback is only needed to react to added or removed inputs.
+// Info() and the stream getters follow the latest resolution, the Inputs field keeps the resolution from startup.
+func (s *Service) OnRewire(callback func(changes []InputChange)) {
+	rewireLock.Lock()
+	defer rewireLock.Unlock()
+
+	rewireCallbacks = append(rewireCallbacks, callback)
+}
+
+// Returns the inputs as currently resolved: the inputs of the service definition, updated with the latest input resolution
+// if rewiring is enabled. Streams that were removed are kept without an address (like optional inputs that roverd did not
+// resolve), streams that were added are appended. The result is a copy that can be modified.
+func currentInputs(inputs []Input) []Input {
+	if !rewiringEnabled.Load() {
+		return inputs
+	}
+	rewireLock.Lock()
+	defer rewireLock.Unlock()
+
+	res := make([]Input, 0, len(inputs))
+	services := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		if input.Service == nil {
+			continue
+		}
+		current := Input{Service: input.Service, Streams: make([]Stream, 0, len(input.Streams))}
+		for _, stream := range input.Streams {
+			if stream.Name == nil {
+				continue
+			}
+			name := fmt.Sprintf("%s-%s", *input.Service, *stream.Name)
+			seen[name] = true
+			resolved := Stream{Name: stream.Name}
+			if r, ok := resolvedInputs[name]; ok {
+				address := r.address
+				resolved.Address = &address
+			}
+			current.Streams = append(current.Streams, resolved)
+		}
+		services[*input.Service] = len(res)
+		res = append(res, current)
+	}
+
+	// Streams that were added since startup, in a stable order
+	added := make([]string, 0)
+	for name := range resolvedInputs {
+		if !seen[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		r := resolvedInputs[name]
+		service, stream, address := r.service, r.stream, r.address
+		i, ok := services[service]
+		if !ok {
+			i = len(res)
+			services[service] = i
+			res = append(res, Input{Service: &service})
+		}
+		res[i].Streams = append(res[i].Streams, Stream{Name: &stream, Address: &address})
+	}
+	return res
+}
+
+// Flatten a list of inputs to the resolution of every stream, by stream name
+func resolveInputs(inputs []Input) map[string]resolvedStream {
+	resolved := make(map[string]resolvedStream)
+	for _, input := range inputs {
+		for _, stream := range input.Streams {
+			if input.Service == nil || stream.Name == nil || stream.Address == nil {
+				continue
+			}
+			resolved[fmt.Sprintf("%s-%s", *input.Service, *stream.Name)] = resolvedStream{
+				service: *input.Service,
+				stream:  *stream.Name,
+				address: *stream.Address,
+			}
+		}
+	}
+	return resolved
+}
+
+// Start accepting updated input resolutions, with the inputs from the service definition as the initial resolution
+func enableRewiring(inputs []Input) {
+	rewireLock.Lock()
+	defer rewireLock.Unlock()
+
+	resolvedInputs = resolveInputs(inputs)
+	rewiringEnabled.Store(true)
+}
+
+// Apply an updated input resolution: reconnect all affected read streams that were handed out and notify the callbacks.
+// Returns the changes, sorted by service and stream name.
+func rewireInputs(inputs []Input) []InputChange {
+	updated := resolveInputs(inputs)
+
+	rewireLock.Lock()
+	var changes []InputChange
+	for name, resolved := range updated {
+		if old := resolvedInputs[name]; old.address != resolved.address {
+			changes = append(changes, InputChange{Service: resolved.service, Stream: resolved.stream, Old: old.address, New: resolved.address})
+		}
+	}
+	for name, old := range resolvedInputs {
+		if _, ok := updated[name]; !ok {
+			changes = append(changes, InputChange{Service: old.service, Stream: old.stream, Old: old.address})
+		}
+	}
+	resolvedInputs = updated
+	callbacks := append([]func([]InputChange){}, rewireCallbacks...)
+	rewireLock.Unlock()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Service != changes[j].Service {
+			return changes[i].Service < changes[j].Service
+		}
+		return changes[i].Stream < changes[j].Stream
+	})
+
+	// Streams are reconnected (or disconnected, if removed) by their reader, because zmq sockets cannot be shared between goroutines
+	streamsLock.Lock()
+	for _, change := range changes {
+		if stream, ok := readStreams[fmt.Sprintf("%s-%s", change.Service, change.Stream)]; ok {
+			address := change.New
+			stream.pending.Store(&address)
+		}
+	}
+	streamsLock.Unlock()
+
+	for _, change := range changes {
+		log.Info().Str("service", change.Service).Str("stream", change.Stream).Str("old", change.Old).Str("new", change.New).Msg("Input stream was rewired")
+	}
+	for _, callback := range callbacks {
+		callback(changes)
+	}
+	return changes
+}
+
+// Decode an input resolution, as published by roverd
+func parseInputs(data []byte) ([]Input, error) {
+	var inputs []Input
+	err := json.Unmarshal(data, &inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode input resolution: %w", err)
+	}
+	return inputs, nil
+}
+
+// Receive input resolutions published by roverd on the control socket. This blocks until the socket fails.
+func subscribeRewiring(address string) error {
+	socket, err := zmq4.NewSocket(zmq4.SUB)
+	if err != nil {
+		return fmt.Errorf("Failed to create rewiring socket at %s: %w", address, err)
+	}
+	defer socket.Close()
+	if security != nil {
+		err = security.client(socket, rewiringPeer)
+		if err != nil {
+			return err
+		}
+		err = monitorHandshakes(socket, "rewiring", nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = socket.Connect(address)
+	if err != nil {
+		return fmt.Errorf("Failed to connect rewiring socket to %s: %w", address, err)
+	}
+	err = socket.SetSubscribe("")
+	if err != nil {
+		return fmt.Errorf("Failed to set subscription on rewiring socket: %w", err)
+	}
+
+	for {
+		data, err := socket.RecvBytes(0)
+		if err != nil {
+			return fmt.Errorf("Failed to receive input resolution: %w", err)
+		}
+		inputs, err := parseInputs(data)
+		if err != nil {
+			log.Warn().Err(err).Msg("Ignoring malformed input resolution")
+			continue
+		}
+		rewireInputs(inputs)
+	}
+}
+
+// Check the watched file for input resolutions on every interval. This blocks forever, a missing or malformed file is ignored.
+func watchRewiring(path string, interval time.Duration) {
+	var last []byte
+	for {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to read input resolution")
+		} else if err == nil && !bytes.Equal(data, last) {
+			last = data
+			inputs, err := parseInputs(data)
+			if err != nil {
+				log.Warn().Err(err).Str("path", path).Msg("Ignoring malformed input resolution")
+			} else {
+				rewireInputs(inputs)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,111 @@
+package roverlib
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func rewiringInputs(addresses map[string]string) []Input {
+	service := "imaging"
+	var streams []Stream
+	for _, name := range []string{"track-data", "debug-info", "raw-frames"} {
+		if address, ok := addresses[name]; ok {
+			name, address := name, address
+			streams = append(streams, Stream{Name: &name, Address: &address})
+		}
+	}
+	return []Input{{Service: &service, Streams: streams}}
+}
+
+// Tests that rewired inputs are reported, handed out read streams get a pending reconnect and callbacks are notified
+func TestRewireInputs(t *testing.T) {
+	initial := rewiringInputs(map[string]string{"track-data": "tcp://localhost:7890", "debug-info": "tcp://localhost:7891"})
+	service := Service{Inputs: initial}
+	enableRewiring(initial)
+	defer func() {
+		rewiringEnabled.Store(false)
+		rewireCallbacks = nil
+	}()
+
+	stream := service.GetReadStream("imaging", "track-data")
+	if stream == nil {
+		t.Fatalf("GetReadStream returned nil for existing stream")
+	}
+
+	var notified []InputChange
+	service.OnRewire(func(changes []InputChange) {
+		notified = changes
+	})
+
+	changes := rewireInputs(rewiringInputs(map[string]string{"track-data": "tcp://localhost:7990", "raw-frames": "tcp://localhost:7892"}))
+	want := []InputChange{
+		{Service: "imaging", Stream: "debug-info", Old: "tcp://localhost:7891"},
+		{Service: "imaging", Stream: "raw-frames", New: "tcp://localhost:7892"},
+		{Service: "imaging", Stream: "track-data", Old: "tcp://localhost:7890", New: "tcp://localhost:7990"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("rewireInputs() = %+v, want %+v", changes, want)
+	}
+	if !reflect.DeepEqual(notified, want) {
+		t.Fatalf("callback was notified of %+v, want %+v", notified, want)
+	}
+
+	pending := stream.pending.Load()
+	if pending == nil || *pending != "tcp://localhost:7990" {
+		t.Fatalf("Expected a pending reconnect to tcp://localhost:7990, got %v", pending)
+	}
+
+	// Inputs that were added at runtime can be fetched too
+	added := service.GetReadStream("imaging", "raw-frames")
+	if added == nil || added.stream.address != "tcp://localhost:7892" {
+		t.Fatalf("Expected read stream for added input at tcp://localhost:7892, got %v", added)
+	}
+
+	// The service view follows the latest resolution, removed inputs are left without an address
+	info, _ := service.Input("imaging")
+	wantInfo := InputInfo{Service: "imaging", Streams: []StreamInfo{
+		{Name: "track-data", Address: "tcp://localhost:7990"},
+		{Name: "debug-info"},
+		{Name: "raw-frames", Address: "tcp://localhost:7892"},
+	}}
+	if !reflect.DeepEqual(info, wantInfo) {
+		t.Fatalf("Input(imaging) = %+v, want %+v", info, wantInfo)
+	}
+	removed, err := service.ReadStreamE("imaging", "debug-info")
+	if err != nil || removed.Available() {
+		t.Fatalf("ReadStreamE(debug-info) = %v, %v, want an unavailable stream", removed, err)
+	}
+
+	// A handed out stream of an input that is removed is disconnected on its next read
+	rewireInputs(rewiringInputs(map[string]string{"raw-frames": "tcp://localhost:7892"}))
+	if stream.Available() {
+		t.Fatalf("Expected the stream of a removed input to be unavailable")
+	}
+	if _, err := stream.ReadBytes(); !errors.Is(err, ErrStreamUnavailable) {
+		t.Fatalf("ReadBytes returned %v, want ErrStreamUnavailable", err)
+	}
+	if stream.stream.address != "" {
+		t.Fatalf("Expected the stream of a removed input to be disconnected, got address %s", stream.stream.address)
+	}
+
+	// Applying the same resolution again changes nothing
+	if changes := rewireInputs(rewiringInputs(map[string]string{"raw-frames": "tcp://localhost:7892"})); changes != nil {
+		t.Fatalf("Expected no changes, got %+v", changes)
+	}
+}
+
+// Tests that malformed input resolutions are rejected
+func TestParseInputs(t *testing.T) {
+	inputs, err := parseInputs([]byte(`[{"service": "imaging", "streams": [{"name": "track-data", "address": "tcp://localhost:7890"}]}]`))
+	if err != nil {
+		t.Fatalf("parseInputs returned %v", err)
+	}
+	if len(inputs) != 1 || *inputs[0].Streams[0].Address != "tcp://localhost:7890" {
+		t.Fatalf("parseInputs returned %+v", inputs)
+	}
+
+	if _, err := parseInputs([]byte(`{"service": "imaging"}`)); err == nil {
+		t.Fatalf("Expected error for malformed input resolution")
+	}
+}
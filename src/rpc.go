@@ -0,0 +1,310 @@
+//
+// Functionality and methods for request/reply interactions between services (e.g. asking the navigation service to recompute a route)
+// requests are sent over a REQ socket and served on a REP socket, replies consist of a status frame followed by a payload frame
+//
+
+package roverlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Used when the bootspec does not specify a timeout or retry count for an endpoint
+const defaultRequestTimeout = 1000 // ms
+const defaultRequestRetries = 3
+
+// Status frames that precede the payload of a reply
+const replyOk = "ok"
+const replyError = "error"
+
+// Returned when no reply was received after all retries
+var ErrRequestTimeout = errors.New("request timed out")
+
+// Map of all already handed out request streams to the user program (to preserve singletons)
+var requestStreams = make(map[string]*RequestStream)
+var requestStreamsLock sync.Mutex
+
+// The function that handles a single request on a served endpoint. The returned bytes are sent back as the reply,
+// a returned error is sent back to the requesting service instead. Use ServeProto to handle protobuf messages.
+type RequestHandler func(request []byte) ([]byte, error)
+
+type RequestStream struct {
+	stream serviceStream
+	// The service that serves the endpoint, whose public key is used if security is enabled
+	peer    string
+	timeout time.Duration
+	retries int
+}
+
+// Get a stream that you can send requests on (i.e. a request/reply dependency).
+// Returns nil if the endpoint does not exist, so check the result before use.
+func (s *Service) GetRequestStream(service string, name string) *RequestStream {
+	streamName := fmt.Sprintf("%s-%s", service, name)
+	requestStreamsLock.Lock()
+	defer requestStreamsLock.Unlock()
+
+	// Is this stream already handed out?
+	if stream, ok := requestStreams[streamName]; ok {
+		return stream
+	}
+
+	// Does this endpoint exist?
+	for _, request := range s.Requests {
+		if request.Service == nil || *request.Service != service {
+			continue
+		}
+		for _, endpoint := range request.Endpoints {
+			if endpoint.Name == nil || *endpoint.Name != name || endpoint.Address == nil {
+				continue
+			}
+
+			res := &RequestStream{
+				stream: serviceStream{
+					name:    streamName,
+					address: *endpoint.Address,
+				},
+				peer:    service,
+				timeout: defaultRequestTimeout * time.Millisecond,
+				retries: defaultRequestRetries,
+			}
+			if endpoint.Timeout != nil && *endpoint.Timeout > 0 {
+				res.timeout = time.Duration(*endpoint.Timeout) * time.Millisecond
+			}
+			if endpoint.Retries != nil && *endpoint.Retries >= 0 {
+				res.retries = int(*endpoint.Retries)
+			}
+			requestStreams[streamName] = res
+			return res
+		}
+	}
+
+	log.Error().Msgf("Request endpoint %s does not exist. Update your program code or service.yaml", streamName)
+	return nil
+}
+
+// Override the time to wait for a reply before retrying (as configured in the bootspec)
+func (r *RequestStream) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// Override the amount of retries for a request that timed out (as configured in the bootspec)
+func (r *RequestStream) SetRetries(retries int) {
+	r.retries = retries
+}
+
+// Initial setup of the stream (done lazily, on the first request, or after a timeout)
+func (r *RequestStream) init() error {
+	// Already initialized
+	if r.stream.socket != nil {
+		return nil
+	}
+
+	socket, err := zmq4.NewSocket(zmq4.REQ)
+	if err != nil {
+		return fmt.Errorf("Failed to create request socket at %s: %w", r.stream.address, err)
+	}
+	// Do not hold on to unanswered requests when the socket is closed after a timeout
+	err = socket.SetLinger(0)
+	if err != nil {
+		socket.Close()
+		return fmt.Errorf("Failed to set linger on request socket: %w", err)
+	}
+	if security != nil {
+		err = security.client(socket, r.peer)
+		if err == nil {
+			err = monitorHandshakes(socket, r.stream.name, &r.stream.handshake)
+		}
+		if err != nil {
+			socket.Close()
+			return err
+		}
+	}
+	err = socket.Connect(r.stream.address)
+	if err != nil {
+		discardSocket(socket)
+		return fmt.Errorf("Failed to connect request socket to %s: %w", r.stream.address, err)
+	}
+	r.stream.socket = socket
+	return nil
+}
+
+// A REQ socket cannot send again without receiving a reply first, so after a timeout the socket is recreated
+func (r *RequestStream) reset() {
+	if r.stream.socket != nil {
+		r.stream.socket.Close()
+		r.stream.socket = nil
+	}
+}
+
+// Send a request and wait for the reply, retrying on timeouts
+func (r *RequestStream) RequestBytes(data []byte) ([]byte, error) {
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		err := r.init()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = r.stream.socket.SendBytes(data, 0)
+		if err != nil {
+			r.reset()
+			return nil, fmt.Errorf("Failed to send request: %w", err)
+		}
+		r.stream.bytes.Add(uint64(len(data)))
+
+		poller := zmq4.NewPoller()
+		poller.Add(r.stream.socket, zmq4.POLLIN)
+		polled, err := poller.Poll(r.timeout)
+		if err != nil {
+			r.reset()
+			return nil, fmt.Errorf("Failed to wait for reply: %w", err)
+		}
+		if len(polled) == 0 {
+			// Retrying does not help if the server rejected our keys
+			err := r.stream.handshakeError()
+			if err != nil {
+				r.reset()
+				return nil, err
+			}
+			log.Warn().Str("endpoint", r.stream.name).Int("attempt", attempt+1).Msg("No reply received in time, retrying")
+			r.reset()
+			continue
+		}
+
+		frames, err := r.stream.socket.RecvMessageBytes(0)
+		if err != nil {
+			r.reset()
+			return nil, fmt.Errorf("Failed to receive reply: %w", err)
+		}
+		r.stream.messages.Add(1)
+		return parseReply(frames)
+	}
+
+	return nil, fmt.Errorf("%w: no reply from %s after %d attempts", ErrRequestTimeout, r.stream.name, r.retries+1)
+}
+
+// Send a protobuf request and unmarshal the reply into the given protobuf message
+func (r *RequestStream) Request(request proto.Message, reply proto.Message) error {
+	if request == nil || reply == nil {
+		return fmt.Errorf("Cannot send nil request or receive into nil reply")
+	}
+
+	buf, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	res, err := r.RequestBytes(buf)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(res, reply)
+}
+
+// Serve requests on the endpoint with the given name, as declared in the bootspec. This blocks until the socket fails,
+// so you will probably want to run it in a goroutine.
+func (s *Service) Serve(name string, handler RequestHandler) error {
+	var address string
+	for _, endpoint := range s.Endpoints {
+		if endpoint.Name != nil && *endpoint.Name == name && endpoint.Address != nil {
+			// ZMQ wants to bind to tcp://*:port addresses, so if roverd gave us a localhost, we need to change it to *
+			address = strings.Replace(*endpoint.Address, "localhost", "*", 1)
+		}
+	}
+	if address == "" {
+		return fmt.Errorf("Endpoint %s does not exist. Update your program code or service.yaml", name)
+	}
+
+	socket, err := zmq4.NewSocket(zmq4.REP)
+	if err != nil {
+		return fmt.Errorf("Failed to create reply socket at %s: %w", address, err)
+	}
+	defer socket.Close()
+	if security != nil {
+		err = security.serve(socket)
+		if err != nil {
+			return err
+		}
+		err = monitorHandshakes(socket, name, nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = socket.Bind(address)
+	if err != nil {
+		return fmt.Errorf("Failed to bind reply socket to %s: %w", address, err)
+	}
+
+	log.Info().Str("endpoint", name).Str("address", address).Msg("Serving requests")
+	for {
+		request, err := socket.RecvBytes(0)
+		if err != nil {
+			return fmt.Errorf("Failed to receive request: %w", err)
+		}
+
+		status, payload := handleRequest(handler, request)
+		_, err = socket.SendMessage(status, payload)
+		if err != nil {
+			return fmt.Errorf("Failed to send reply: %w", err)
+		}
+	}
+}
+
+// Serve protobuf requests on the endpoint with the given name, the counterpart of RequestStream.Request. Every request is
+// unmarshalled into a new message of the type that the handler accepts, and the returned reply is marshalled and sent back.
+// This blocks until the socket fails, like Serve.
+func ServeProto[Req any, Reply proto.Message, PReq interface {
+	*Req
+	proto.Message
+}](s *Service, name string, handler func(request PReq) (Reply, error)) error {
+	return s.Serve(name, protoHandler(handler))
+}
+
+// Wrap a protobuf handler in a handler for the raw bytes of requests and replies
+func protoHandler[Req any, Reply proto.Message, PReq interface {
+	*Req
+	proto.Message
+}](handler func(request PReq) (Reply, error)) RequestHandler {
+	return func(data []byte) ([]byte, error) {
+		request := PReq(new(Req))
+		err := proto.Unmarshal(data, request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal request: %w", err)
+		}
+		reply, err := handler(request)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(reply)
+	}
+}
+
+// Run the handler and convert its result to the status and payload frames of a reply
+func handleRequest(handler RequestHandler, request []byte) (string, []byte) {
+	reply, err := handler(request)
+	if err != nil {
+		return replyError, []byte(err.Error())
+	}
+	return replyOk, reply
+}
+
+// Convert the frames of a reply back to the payload, or the error returned by the handler
+func parseReply(frames [][]byte) ([]byte, error) {
+	if len(frames) != 2 {
+		return nil, fmt.Errorf("Malformed reply with %d frames", len(frames))
+	}
+	switch string(frames[0]) {
+	case replyOk:
+		return frames[1], nil
+	case replyError:
+		return nil, fmt.Errorf("Remote handler failed: %s", string(frames[1]))
+	default:
+		return nil, fmt.Errorf("Malformed reply with status %q", string(frames[0]))
+	}
+}
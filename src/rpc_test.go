@@ -0,0 +1,105 @@
+package roverlib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
+	"google.golang.org/protobuf/proto"
+)
+
+// A small Service that depends on one request endpoint of another service
+func sampleServiceRequest() Service {
+	service, name, address := "navigation", "recompute-route", "tcp://unix:7900"
+	timeout, retries := int64(250), int64(1)
+	return Service{
+		Requests: []Request{{Service: &service, Endpoints: []Endpoint{{Name: &name, Address: &address, Timeout: &timeout, Retries: &retries}}}},
+	}
+}
+
+// Tests that GetRequestStream applies the bootspec timeout and retries, and returns singletons
+func TestGetRequestStreamHappy(t *testing.T) {
+	service := sampleServiceRequest()
+
+	stream := service.GetRequestStream("navigation", "recompute-route")
+	if stream == nil {
+		t.Fatalf("GetRequestStream returned nil for existing endpoint")
+	}
+	if stream.stream.address != "tcp://unix:7900" {
+		t.Fatalf("Expected address tcp://unix:7900, got %s", stream.stream.address)
+	}
+	if stream.peer != "navigation" {
+		t.Fatalf("Expected the serving service navigation to be the peer, got %s", stream.peer)
+	}
+	if stream.timeout != 250*time.Millisecond || stream.retries != 1 {
+		t.Fatalf("Expected timeout 250ms and 1 retry, got %v and %d", stream.timeout, stream.retries)
+	}
+	if stream != service.GetRequestStream("navigation", "recompute-route") {
+		t.Fatalf("Expected GetRequestStream to return the same instance for the same name")
+	}
+}
+
+// Tests that GetRequestStream and Serve fail for endpoints that were not declared
+func TestRequestEndpointMissing(t *testing.T) {
+	service := sampleServiceRequest()
+
+	if stream := service.GetRequestStream("navigation", "nonExistent"); stream != nil {
+		t.Fatalf("GetRequestStream should return nil for non-existent endpoint, got %v", stream)
+	}
+	if err := service.Serve("nonExistent", nil); err == nil {
+		t.Fatalf("Serve should fail for non-existent endpoint")
+	}
+}
+
+// Tests that handler results and errors survive the reply framing
+func TestReplyFraming(t *testing.T) {
+	status, payload := handleRequest(func(request []byte) ([]byte, error) {
+		return append(request, '!'), nil
+	}, []byte("ping"))
+	reply, err := parseReply([][]byte{[]byte(status), payload})
+	if err != nil || string(reply) != "ping!" {
+		t.Fatalf("parseReply = %q, %v, want \"ping!\"", reply, err)
+	}
+
+	status, payload = handleRequest(func(request []byte) ([]byte, error) {
+		return nil, errors.New("no route")
+	}, []byte("ping"))
+	if _, err := parseReply([][]byte{[]byte(status), payload}); err == nil {
+		t.Fatalf("expected handler error to be returned to the requester")
+	}
+
+	if _, err := parseReply([][]byte{[]byte("ok")}); err == nil {
+		t.Fatalf("expected error for malformed reply")
+	}
+}
+
+// Tests that protobuf handlers receive unmarshalled requests and have their replies marshalled
+func TestProtoHandler(t *testing.T) {
+	handler := protoHandler(func(request *rovercom.SensorOutput) (*rovercom.SensorOutput, error) {
+		if request.SensorId == 0 {
+			return nil, errors.New("missing sensor id")
+		}
+		return &rovercom.SensorOutput{SensorId: request.SensorId, Status: 1}, nil
+	})
+
+	data, err := proto.Marshal(&rovercom.SensorOutput{SensorId: 7})
+	if err != nil {
+		t.Fatalf("Marshal returned %v", err)
+	}
+	res, err := handler(data)
+	if err != nil {
+		t.Fatalf("handler returned %v", err)
+	}
+	reply := &rovercom.SensorOutput{}
+	if err := proto.Unmarshal(res, reply); err != nil || reply.SensorId != 7 || reply.Status != 1 {
+		t.Fatalf("reply = %v, %v, want sensor 7 with status 1", reply, err)
+	}
+
+	if _, err := handler(nil); err == nil {
+		t.Fatalf("expected the error of the handler to be returned")
+	}
+	if _, err := handler([]byte{0xff}); err == nil {
+		t.Fatalf("expected error for a request that cannot be unmarshalled")
+	}
+}
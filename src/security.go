@@ -0,0 +1,287 @@
+//
+// Optional authentication and encryption of streams with CurveZMQ, so that other devices on the network of the rover cannot
+// read from or inject into its streams. Every socket that this service binds (write streams, served endpoints and the
+// heartbeat publisher) acts as a Curve server, every socket that it connects (read streams, request streams, the tuning
+// subscriber and the rewiring subscriber) as a client of the peer it connects to. A failed handshake (e.g. because the
+// keys do not match) is reported as ErrHandshakeFailed.
+//
+
+package roverlib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pebbe/zmq4"
+	"github.com/rs/zerolog/log"
+)
+
+// The ZAP domain that clients of write streams are authenticated in
+const curveDomain = "roverlib"
+
+// The peer name of the publisher of tuning values
+const tuningPeer = "tuning"
+
+// The peer name of the publisher of input resolutions
+const rewiringPeer = "roverd"
+
+// Z85-encoded CurveZMQ keys are 40 characters of the Z85 alphabet
+var curveKeyPattern = regexp.MustCompile(`^[0-9a-zA-Z.\-:+=^!/*?&<>()\[\]{}@%$#]{40}$`)
+
+// Returned when reading from a stream whose producer rejected the keys of this service, or the other way around
+var ErrHandshakeFailed = errors.New("CurveZMQ handshake failed")
+
+// The keys of this service and its peers, nil if security is not enabled.
+// Set by Run before the user program starts, so that all streams use it.
+var security *curveKeys
+
+// The authentication handler is shared by all write streams, so it is only started once
+var authOnce sync.Once
+var authErr error
+
+// Sockets are monitored over inproc addresses, which have to be unique
+var monitors atomic.Uint64
+
+type curveKeys struct {
+	public string
+	secret string
+	// Public keys of other services, by service name
+	peers map[string]string
+}
+
+// Check that a key is a Z85-encoded CurveZMQ key (the key itself is left out of the error, as it might be a secret)
+func validateCurveKey(key string) error {
+	if !curveKeyPattern.MatchString(key) {
+		return fmt.Errorf("not a Z85-encoded CurveZMQ key (got %d characters, want 40 of the Z85 alphabet)", len(key))
+	}
+	return nil
+}
+
+// Read a key from a file in the key directory, ignoring surrounding whitespace
+func readCurveKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(data))
+	if err := validateCurveKey(key); err != nil {
+		return "", fmt.Errorf("key in %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// Load the keys of this service and its peers from the bootspec and key directory.
+// Returns nil if security is not enabled, and an error if it is enabled but the keys are missing or invalid.
+func loadSecurity(s Service) (*curveKeys, error) {
+	if s.Security == nil || s.Security.Enabled == nil || !*s.Security.Enabled {
+		return nil, nil
+	}
+	name := deref(s.Name)
+	directory := deref(s.Security.Keys)
+	keys := &curveKeys{
+		public: deref(s.Security.Public),
+		secret: deref(s.Security.Secret),
+		peers:  make(map[string]string),
+	}
+
+	// Keys in the directory come first, so that the bootspec can override them
+	if directory != "" {
+		paths, err := filepath.Glob(filepath.Join(directory, "*.key"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list keys in %s: %w", directory, err)
+		}
+		for _, path := range paths {
+			key, err := readCurveKey(path)
+			if err != nil {
+				return nil, err
+			}
+			keys.peers[strings.TrimSuffix(filepath.Base(path), ".key")] = key
+		}
+		if keys.public == "" {
+			keys.public = keys.peers[name]
+		}
+		if keys.secret == "" {
+			secret, err := readCurveKey(filepath.Join(directory, name+".secret"))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			keys.secret = secret
+		}
+	}
+	for peer, key := range s.Security.Peers {
+		if err := validateCurveKey(key); err != nil {
+			return nil, fmt.Errorf("public key of peer %s: %w", peer, err)
+		}
+		keys.peers[peer] = key
+	}
+	// This service is not a peer of itself
+	delete(keys.peers, name)
+
+	if keys.public == "" || keys.secret == "" {
+		return nil, fmt.Errorf("security is enabled, but the key pair of service %s is missing (set security.public and security.secret, or add %s.key and %s.secret to the key directory)", name, name, name)
+	}
+	if err := validateCurveKey(keys.public); err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	if err := validateCurveKey(keys.secret); err != nil {
+		return nil, fmt.Errorf("secret key: %w", err)
+	}
+	// Deriving the public key needs ZeroMQ 4.2 or later, so only compare when it is available
+	if derived, err := zmq4.AuthCurvePublic(keys.secret); err == nil && derived != keys.public {
+		return nil, fmt.Errorf("public key does not belong to the secret key of service %s", name)
+	}
+	return keys, nil
+}
+
+// Returns the public key of a peer, or an error that explains where to add it
+func (k *curveKeys) peer(name string) (string, error) {
+	key, ok := k.peers[name]
+	if !ok {
+		return "", fmt.Errorf("no public key for %s, add it to security.peers or as %s.key to the key directory", name, name)
+	}
+	return key, nil
+}
+
+// Make the socket a Curve server that only accepts clients with a known public key (or any client, if no peers are known)
+func (k *curveKeys) serve(socket *zmq4.Socket) error {
+	authOnce.Do(func() {
+		authErr = zmq4.AuthStart()
+		if authErr != nil {
+			return
+		}
+		clients := make([]string, 0, len(k.peers))
+		for _, key := range k.peers {
+			clients = append(clients, key)
+		}
+		sort.Strings(clients)
+		if len(clients) == 0 {
+			log.Warn().Msg("No public keys of peers known, accepting any client with a valid CurveZMQ handshake")
+			clients = append(clients, zmq4.CURVE_ALLOW_ANY)
+		}
+		zmq4.AuthCurveAdd(curveDomain, clients...)
+	})
+	if authErr != nil {
+		return fmt.Errorf("Failed to start CurveZMQ authentication: %w", authErr)
+	}
+
+	err := socket.ServerAuthCurve(curveDomain, k.secret)
+	if err != nil {
+		return fmt.Errorf("Failed to set up CurveZMQ server: %w", err)
+	}
+	return nil
+}
+
+// Make the socket a Curve client of the given peer
+func (k *curveKeys) client(socket *zmq4.Socket, peer string) error {
+	server, err := k.peer(peer)
+	if err != nil {
+		return fmt.Errorf("Failed to set up CurveZMQ client: %w", err)
+	}
+	err = socket.ClientAuthCurve(server, k.public, k.secret)
+	if err != nil {
+		return fmt.Errorf("Failed to set up CurveZMQ client: %w", err)
+	}
+	return nil
+}
+
+// The events of a socket monitor that report the outcome of CurveZMQ handshakes
+const handshakeEvents = zmq4.EVENT_HANDSHAKE_SUCCEEDED | zmq4.EVENT_HANDSHAKE_FAILED_NO_DETAIL | zmq4.EVENT_HANDSHAKE_FAILED_PROTOCOL | zmq4.EVENT_HANDSHAKE_FAILED_AUTH
+
+// Report the handshakes on the socket, so that mismatching keys do not go unnoticed. The last failure is stored in
+// handshake (if not nil) until a handshake succeeds. Must be called before the socket is bound or connected.
+func monitorHandshakes(socket *zmq4.Socket, name string, handshake *atomic.Pointer[error]) error {
+	return monitorSocket(socket, name, handshakeEvents, func(event zmq4.Event, peer string) {
+		reportHandshake(event, name, peer, handshake)
+	})
+}
+
+// Pass the given events of the socket to handle, from a separate goroutine. A socket can only have one monitor, so all
+// events of interest have to be requested at once. Must be called before the socket is bound or connected.
+// The monitor stops when the socket is closed.
+func monitorSocket(socket *zmq4.Socket, name string, events zmq4.Event, handle func(event zmq4.Event, peer string)) error {
+	address := fmt.Sprintf("inproc://roverlib-monitor-%d", monitors.Add(1))
+	// Closing the socket stops its monitor, which is the signal to clean up the monitor socket
+	events |= zmq4.EVENT_MONITOR_STOPPED
+	err := socket.Monitor(address, events)
+	if err != nil {
+		return fmt.Errorf("Failed to monitor %s: %w", name, err)
+	}
+	monitor, err := zmq4.NewSocket(zmq4.PAIR)
+	if err != nil {
+		socket.Monitor("", 0)
+		return fmt.Errorf("Failed to create monitor for %s: %w", name, err)
+	}
+	err = monitor.Connect(address)
+	if err != nil {
+		monitor.Close()
+		socket.Monitor("", 0)
+		return fmt.Errorf("Failed to connect monitor for %s: %w", name, err)
+	}
+
+	go func() {
+		defer monitor.Close()
+		for {
+			event, peer, _, err := monitor.RecvEvent(0)
+			if err != nil || event == zmq4.EVENT_MONITOR_STOPPED {
+				return
+			}
+			handle(event, peer)
+		}
+	}()
+	return nil
+}
+
+// Log the outcome of a handshake, and store it in handshake (if not nil). Other events are ignored.
+func reportHandshake(event zmq4.Event, name string, peer string, handshake *atomic.Pointer[error]) {
+	if event&handshakeEvents == 0 {
+		return
+	}
+	if event == zmq4.EVENT_HANDSHAKE_SUCCEEDED {
+		if handshake != nil {
+			handshake.Store(nil)
+		}
+		log.Debug().Str("stream", name).Str("peer", peer).Msg("CurveZMQ handshake succeeded")
+		return
+	}
+
+	err := handshakeError(event, name, peer)
+	if handshake != nil {
+		handshake.Store(&err)
+	}
+	log.Error().Err(err).Msg("Check the keys in the bootspec or key directory")
+}
+
+// Close a socket that failed to set up, stopping its handshake monitor (if any) first
+func discardSocket(socket *zmq4.Socket) {
+	socket.Monitor("", 0)
+	socket.Close()
+}
+
+// Describe a failed handshake
+func handshakeError(event zmq4.Event, name string, peer string) error {
+	reason := "unknown reason"
+	switch event {
+	case zmq4.EVENT_HANDSHAKE_FAILED_AUTH:
+		reason = "the peer rejected our key, or we rejected theirs"
+	case zmq4.EVENT_HANDSHAKE_FAILED_PROTOCOL:
+		reason = "protocol error, the peer might not use CurveZMQ or use a different server key"
+	case zmq4.EVENT_HANDSHAKE_FAILED_NO_DETAIL:
+		reason = "the keys do not match"
+	}
+	return fmt.Errorf("%w on %s with %s: %s", ErrHandshakeFailed, name, peer, reason)
+}
+
+// Returns the error of the last failed handshake on the stream, if no handshake succeeded since
+func (s *serviceStream) handshakeError() error {
+	if err := s.handshake.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package roverlib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pebbe/zmq4"
+)
+
+// Key pairs from the CurveZMQ reference (zmq_curve)
+const testServerPublic = "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+const testServerSecret = "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+const testClientPublic = "Yne@$w-vo<fVvi]a<NY6T1ed:M$fCG*[IaLV{hID"
+
+// Tests that keys are loaded from the bootspec
+func TestLoadSecurityBootspec(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "controller",
+		"security": {
+			"enabled": true,
+			"public": "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7",
+			"secret": "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6",
+			"peers": {"imaging": "Yne@$w-vo<fVvi]a<NY6T1ed:M$fCG*[IaLV{hID"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	keys, err := loadSecurity(service)
+	if err != nil {
+		t.Fatalf("loadSecurity returned %v", err)
+	}
+	if keys.public != testServerPublic || keys.secret != testServerSecret {
+		t.Fatalf("loadSecurity did not load the key pair of the service")
+	}
+	if key, err := keys.peer("imaging"); err != nil || key != testClientPublic {
+		t.Fatalf("peer(imaging) = %q, %v", key, err)
+	}
+	if _, err := keys.peer(tuningPeer); err == nil {
+		t.Fatalf("expected error for unknown peer")
+	}
+	if err := keys.client(nil, tuningPeer); err == nil {
+		t.Fatalf("expected client setup to fail for unknown peer")
+	}
+}
+
+// Tests that keys are loaded from the key directory, and that the service is not a peer of itself
+func TestLoadSecurityDirectory(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"controller.key":    testServerPublic,
+		"controller.secret": testServerSecret + "\n",
+		"tuning.key":        testClientPublic,
+	}
+	for name, key := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(key), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	enabled := true
+	name := "controller"
+	keys, err := loadSecurity(Service{Name: &name, Security: &Security{Enabled: &enabled, Keys: &directory}})
+	if err != nil {
+		t.Fatalf("loadSecurity returned %v", err)
+	}
+	if keys.public != testServerPublic || keys.secret != testServerSecret {
+		t.Fatalf("loadSecurity did not load the key pair of the service from the key directory")
+	}
+	if _, err := keys.peer("controller"); err == nil {
+		t.Fatalf("expected the service not to be its own peer")
+	}
+	if key, err := keys.peer(tuningPeer); err != nil || key != testClientPublic {
+		t.Fatalf("peer(tuning) = %q, %v", key, err)
+	}
+}
+
+// Tests that missing and invalid keys are reported, and that security is off by default
+func TestLoadSecurityInvalid(t *testing.T) {
+	if keys, err := loadSecurity(Service{}); keys != nil || err != nil {
+		t.Fatalf("loadSecurity() = %v, %v, want security to be disabled", keys, err)
+	}
+
+	enabled := true
+	name := "controller"
+	public := testServerPublic
+	if _, err := loadSecurity(Service{Name: &name, Security: &Security{Enabled: &enabled, Public: &public}}); err == nil {
+		t.Fatalf("expected error for missing secret key")
+	}
+
+	secret := testServerSecret
+	peers := map[string]string{"imaging": "not-a-key"}
+	if _, err := loadSecurity(Service{Name: &name, Security: &Security{Enabled: &enabled, Public: &public, Secret: &secret, Peers: peers}}); err == nil {
+		t.Fatalf("expected error for invalid peer key")
+	}
+
+	short := "too-short"
+	service := Service{Security: &Security{Secret: &short}}
+	if err := service.Validate(); err == nil || !strings.Contains(err.Error(), "security.secret: not a Z85-encoded CurveZMQ key") {
+		t.Fatalf("Validate returned %v, want the invalid secret key to be reported", err)
+	}
+	if strings.Contains(service.Validate().Error(), short) {
+		t.Fatalf("Validate should not include the secret key in its error")
+	}
+}
+
+// Tests that failed handshakes are reported as ErrHandshakeFailed
+func TestHandshakeError(t *testing.T) {
+	err := handshakeError(zmq4.EVENT_HANDSHAKE_FAILED_AUTH, "imaging-track-data", "tcp://localhost:7890")
+	if !errors.Is(err, ErrHandshakeFailed) {
+		t.Fatalf("handshakeError() = %v, want ErrHandshakeFailed", err)
+	}
+
+	stream := &ReadStream{}
+	if err := stream.stream.handshakeError(); err != nil {
+		t.Fatalf("handshakeError() = %v, want nil before any handshake", err)
+	}
+	stream.stream.handshake.Store(&err)
+	if err := stream.stream.handshakeError(); !errors.Is(err, ErrHandshakeFailed) {
+		t.Fatalf("handshakeError() = %v, want ErrHandshakeFailed", err)
+	}
+}
@@ -6,8 +6,13 @@
 package roverlib
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/outputs"
 	"github.com/pebbe/zmq4"
@@ -19,78 +24,188 @@ import (
 var writeStreams = make(map[string]*WriteStream)
 var readStreams = make(map[string]*ReadStream)
 
+// Protects the stream maps above, which are also read by the heartbeat publisher
+var streamsLock sync.Mutex
+
 type serviceStream struct {
+	// The name under which this stream was handed out
+	name string
 	// The socket that this stream is connected to
 	address string       // zmq address
 	socket  *zmq4.Socket // can be nil, when lazy loading
-	// Amount of bytes read/written so far
-	bytes int
+	// Amount of bytes and messages read/written so far (atomic, because they are also read by the heartbeat publisher)
+	bytes    atomic.Uint64
+	messages atomic.Uint64
+	// Amount of messages that were not written because of rate limiting or decimation
+	suppressed atomic.Uint64
+	// The last failed CurveZMQ handshake, if security is enabled
+	handshake atomic.Pointer[error]
+}
+
+// Statistics of a single stream, as reported in the heartbeat
+type StreamStats struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	// Only reported for write streams with a rate limit or decimation
+	Suppressed uint64 `json:"suppressed,omitempty"`
+}
+
+func (s *serviceStream) stats() StreamStats {
+	return StreamStats{
+		Name:       s.name,
+		Address:    s.address,
+		Messages:   s.messages.Load(),
+		Bytes:      s.bytes.Load(),
+		Suppressed: s.suppressed.Load(),
+	}
 }
 
 type WriteStream struct {
-	stream serviceStream
+	stream      serviceStream
+	limits      writeLimits
+	compression writeCompression
 }
 
 type ReadStream struct {
 	stream serviceStream
+	// The service that produces this stream
+	peer string
+	// The address to reconnect to on the next read, if the input was rewired
+	pending atomic.Pointer[string]
 }
 
+// Returned when a stream is not declared in the service definition
+var ErrStreamNotFound = errors.New("stream does not exist")
+
+// Returned when reading from an optional input that roverd did not resolve
+var ErrStreamUnavailable = errors.New("stream is not available")
+
 // Get a stream that you can write to (i.e. an output stream).
-// This function panics if the stream does not exist, because fetching a non-existent stream should always terminate to avoid undefined behavior.
+// Returns nil if the stream does not exist, use WriteStreamE to get the error instead.
 func (s *Service) GetWriteStream(name string) *WriteStream {
+	stream, err := s.WriteStreamE(name)
+	if err != nil {
+		log.Error().Err(err).Msg("Update your program code or service.yaml")
+		return nil
+	}
+	return stream
+}
+
+// Get a stream that you can write to (i.e. an output stream), or an error wrapping ErrStreamNotFound if it does not exist
+func (s *Service) WriteStreamE(name string) (*WriteStream, error) {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
 	// Is this stream already handed out?
 	if stream, ok := writeStreams[name]; ok {
-		return stream
+		return stream, nil
 	}
 
 	// Does this stream exist?
 	for _, output := range s.Outputs {
-		if *output.Name == name {
+		if output.Name != nil && *output.Name == name && output.Address != nil {
 			// ZMQ wants to bind write streams to tcp://*:port addresses, so if roverd gave us a localhost, we need to change it to *
 			address := strings.Replace(*output.Address, "localhost", "*", 1)
 
 			// Create a new stream
-			stream := &serviceStream{
-				address: address,
+			res := &WriteStream{
+				stream: serviceStream{
+					name:    name,
+					address: address,
+				},
+				compression: outputCompression(output),
 			}
-			res := &WriteStream{stream: *stream}
 			writeStreams[name] = res
-			return res
+			return res, nil
 		}
 	}
 
-	log.Error().Msgf("Output stream %s does not exist. Update your program code or service.yaml", name)
-	return nil
+	return nil, fmt.Errorf("%w: output stream %s", ErrStreamNotFound, name)
 }
 
 // Get a stream that you can read from (i.e. an input stream).
-// This function panics if the stream does not exist, because fetching a non-existent stream should always terminate to avoid undefined behavior.
+// Returns nil if the stream does not exist, use ReadStreamE to get the error instead.
 func (s *Service) GetReadStream(service string, name string) *ReadStream {
+	stream, err := s.ReadStreamE(service, name)
+	if err != nil {
+		log.Error().Err(err).Msg("Update your program code or service.yaml")
+		return nil
+	}
+	return stream
+}
+
+// Get a stream that you can read from (i.e. an input stream), or an error wrapping ErrStreamNotFound if it does not exist.
+// An optional input that is declared but that roverd did not resolve yields a stream that is not Available().
+func (s *Service) ReadStreamE(service string, name string) (*ReadStream, error) {
 	streamName := fmt.Sprintf("%s-%s", service, name)
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
 	// Is this stream already handed out?
 	if stream, ok := readStreams[streamName]; ok {
-		return stream
+		return stream, nil
 	}
 
-	// Does this stream exist?
-	for _, input := range s.Inputs {
-		if *input.Service == service {
+	// Does this stream exist? (an input without an address was not resolved, or removed since startup)
+	declared := false
+	for _, input := range currentInputs(s.Inputs) {
+		if input.Service != nil && *input.Service == service {
 			for _, stream := range input.Streams {
-				if *stream.Name == name {
-					// Create a new stream
-					stream := &serviceStream{
-						address: *stream.Address,
+				if stream.Name != nil && *stream.Name == name {
+					declared = true
+					if stream.Address != nil && *stream.Address != "" {
+						// Create a new stream
+						res := &ReadStream{
+							stream: serviceStream{
+								name:    streamName,
+								address: *stream.Address,
+							},
+							peer: service,
+						}
+						readStreams[streamName] = res
+						return res, nil
 					}
-					res := &ReadStream{stream: *stream}
-					readStreams[streamName] = res
-					return res
 				}
 			}
 		}
 	}
 
-	log.Error().Msgf("Input stream %s does not exist. Update your program code or service.yaml", streamName)
-	return nil
+	// Inputs that are declared in the service.yaml, but left out by roverd, are optional inputs that were not resolved
+	if metadata, err := s.Metadata(); err == nil && !declared {
+		for _, input := range metadata.Inputs {
+			for _, stream := range input.Streams {
+				if input.Service == service && stream == name {
+					declared = true
+				}
+			}
+		}
+	}
+	if declared {
+		res := &ReadStream{
+			stream: serviceStream{
+				name: streamName,
+			},
+			peer: service,
+		}
+		readStreams[streamName] = res
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("%w: input stream %s", ErrStreamNotFound, streamName)
+}
+
+// Whether the input was resolved by roverd, reading from an unavailable stream returns ErrStreamUnavailable.
+// An unavailable stream becomes available when the input is rewired to an address, and unavailable when it is removed.
+func (s *ReadStream) Available() bool {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	if pending := s.pending.Load(); pending != nil {
+		return *pending != ""
+	}
+	return s.stream.address != ""
 }
 
 // Initial setup of the stream (done lazily, on the first read)
@@ -105,16 +220,31 @@ func (s *ReadStream) init() error {
 	if err != nil {
 		return fmt.Errorf("Failed to create read socket at %s: %w", s.stream.address, err)
 	}
+	if security != nil {
+		err = security.client(socket, s.peer)
+		if err != nil {
+			socket.Close()
+			return err
+		}
+		err = monitorHandshakes(socket, s.stream.name, &s.stream.handshake)
+		if err != nil {
+			socket.Close()
+			return err
+		}
+	}
 	err = socket.Connect(s.stream.address)
 	if err != nil {
+		discardSocket(socket)
 		return fmt.Errorf("Failed to connect read socket to %s: %w", s.stream.address, err)
 	}
 	err = socket.SetSubscribe("")
 	if err != nil {
+		discardSocket(socket)
 		return fmt.Errorf("Failed to set subscription on read socket: %w", err)
 	}
 	s.stream.socket = socket
-	s.stream.bytes = 0
+	s.stream.bytes.Store(0)
+	s.stream.messages.Store(0)
 	return nil
 }
 
@@ -130,17 +260,48 @@ func (s *WriteStream) init() error {
 	if err != nil {
 		return fmt.Errorf("Failed to create write socket at %s: %w", s.stream.address, err)
 	}
+	if security != nil {
+		err = security.serve(socket)
+		if err != nil {
+			socket.Close()
+			return err
+		}
+		err = monitorHandshakes(socket, s.stream.name, nil)
+		if err != nil {
+			socket.Close()
+			return err
+		}
+	}
 	err = socket.Bind(s.stream.address)
 	if err != nil {
+		discardSocket(socket)
 		return fmt.Errorf("Failed to bind write socket to %s: %w", s.stream.address, err)
 	}
 	s.stream.socket = socket
-	s.stream.bytes = 0
+	s.stream.bytes.Store(0)
+	s.stream.messages.Store(0)
 	return nil
 }
 
-// Write byte data to the stream
+// Write byte data to the stream (messages that are suppressed by the rate limit or decimation are dropped without error)
 func (s *WriteStream) WriteBytes(data []byte) error {
+	if !s.offer() {
+		return nil
+	}
+	return s.send(data)
+}
+
+// Decide whether the next message is sent, or dropped because the stream is over its rate limit or the message is decimated
+func (s *WriteStream) offer() bool {
+	if !s.admit(time.Now()) {
+		s.stream.suppressed.Add(1)
+		return false
+	}
+	return true
+}
+
+// Compress and write a message that was admitted by the rate limit and decimation
+func (s *WriteStream) send(data []byte) error {
 	if s.stream.socket == nil {
 		err := s.init()
 		if err != nil {
@@ -148,17 +309,32 @@ func (s *WriteStream) WriteBytes(data []byte) error {
 		}
 	}
 
+	data, err := s.compression.apply(data)
+	if err != nil {
+		return err
+	}
+
 	// Write the data
-	_, err := s.stream.socket.SendBytes(data, 0)
+	_, err = s.stream.socket.SendBytes(data, 0)
 	if err != nil {
 		return fmt.Errorf("Failed to write to stream: %w", err)
 	}
-	s.stream.bytes += len(data)
+	s.stream.bytes.Add(uint64(len(data)))
+	s.stream.messages.Add(1)
 	return nil
 }
 
 // Read byte data from the stream
 func (s *ReadStream) ReadBytes() ([]byte, error) {
+	// Follow the input to its new address (or away from it, if it was removed) before reading
+	err := s.reconnect()
+	if err != nil {
+		return nil, err
+	}
+	if s.stream.address == "" {
+		return nil, fmt.Errorf("%w: input stream %s is not resolved", ErrStreamUnavailable, s.stream.name)
+	}
+
 	if s.stream.socket == nil {
 		err := s.init()
 		if err != nil {
@@ -166,13 +342,66 @@ func (s *ReadStream) ReadBytes() ([]byte, error) {
 		}
 	}
 
+	// If the input can be rewired or the handshake can fail, do not block forever on a producer that will never send
+	for rewiringEnabled.Load() || security != nil {
+		err := s.stream.handshakeError()
+		if err != nil {
+			return nil, err
+		}
+		err = s.reconnect()
+		if err != nil {
+			return nil, err
+		}
+		if s.stream.address == "" {
+			return nil, fmt.Errorf("%w: input stream %s was removed", ErrStreamUnavailable, s.stream.name)
+		}
+		poller := zmq4.NewPoller()
+		poller.Add(s.stream.socket, zmq4.POLLIN)
+		polled, err := poller.Poll(rewiringPollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to wait for data on stream: %w", err)
+		}
+		if len(polled) > 0 {
+			break
+		}
+	}
+
 	// Read the data
 	data, err := s.stream.socket.RecvBytes(0)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read from stream: %w", err)
 	}
-	s.stream.bytes += len(data)
-	return data, nil
+	s.stream.bytes.Add(uint64(len(data)))
+	s.stream.messages.Add(1)
+	return decompress(data)
+}
+
+// Move the socket to the address that the input was rewired to, if any. An empty address means that the input was removed,
+// in which case the socket is disconnected.
+func (s *ReadStream) reconnect() error {
+	address := s.pending.Swap(nil)
+	if address == nil || *address == s.stream.address {
+		return nil
+	}
+
+	if s.stream.socket != nil {
+		if s.stream.address != "" {
+			err := s.stream.socket.Disconnect(s.stream.address)
+			if err != nil {
+				log.Warn().Err(err).Str("address", s.stream.address).Msg("Failed to disconnect read socket")
+			}
+		}
+		if *address != "" {
+			err := s.stream.socket.Connect(*address)
+			if err != nil {
+				return fmt.Errorf("Failed to reconnect read socket to %s: %w", *address, err)
+			}
+		}
+	}
+	streamsLock.Lock()
+	s.stream.address = *address
+	streamsLock.Unlock()
+	return nil
 }
 
 // Write a rovercom sensor output message to the stream
@@ -180,6 +409,10 @@ func (s *WriteStream) Write(output *rovercom.SensorOutput) error {
 	if output == nil {
 		return fmt.Errorf("Cannot write nil output")
 	}
+	// Do not spend time on marshalling messages that are dropped anyway
+	if !s.offer() {
+		return nil
+	}
 
 	// Marshal (convert to over-the-wire format)
 	buf, err := proto.Marshal(output)
@@ -188,7 +421,7 @@ func (s *WriteStream) Write(output *rovercom.SensorOutput) error {
 	}
 
 	// Write the data
-	return s.WriteBytes(buf)
+	return s.send(buf)
 }
 
 // Read a rovercom sensor output message from the stream
@@ -209,3 +442,29 @@ func (s *ReadStream) Read() (*rovercom.SensorOutput, error) {
 
 	return output, nil
 }
+
+// Get the amount of messages and bytes written to this stream so far
+func (s *WriteStream) Stats() StreamStats {
+	return s.stream.stats()
+}
+
+// Get the amount of messages and bytes read from this stream so far
+func (s *ReadStream) Stats() StreamStats {
+	return s.stream.stats()
+}
+
+// Collect the statistics of all streams that were handed out to the user program so far
+func collectStreamStats() (outputs []StreamStats, inputs []StreamStats) {
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	for _, stream := range writeStreams {
+		outputs = append(outputs, stream.Stats())
+	}
+	for _, stream := range readStreams {
+		inputs = append(inputs, stream.Stats())
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Name < outputs[j].Name })
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].Name < inputs[j].Name })
+	return outputs, inputs
+}
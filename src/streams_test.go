@@ -2,6 +2,7 @@ package roverlib
 
 import (
 
+	"errors"
 	"testing"
 
 )
@@ -88,4 +89,48 @@ func TestGetReadStreamMissing(t *testing.T) {
 	if input_stream != nil {
 		t.Fatalf("GetReadStream should return nil for non-existent stream, got %v", input_stream)
 	}
-}
\ No newline at end of file
+}
+
+// Tests that the error-returning variants report missing streams
+func TestStreamEMissing(t *testing.T) {
+	service := sampleServiceStream()
+
+	if _, err := service.WriteStreamE("nonExistentOutput"); !errors.Is(err, ErrStreamNotFound) {
+		t.Fatalf("WriteStreamE returned %v, want ErrStreamNotFound", err)
+	}
+	if _, err := service.ReadStreamE("nonExistentService", "nonExistentInput"); !errors.Is(err, ErrStreamNotFound) {
+		t.Fatalf("ReadStreamE returned %v, want ErrStreamNotFound", err)
+	}
+	if stream, err := service.ReadStreamE("testService", "testInput"); err != nil || !stream.Available() {
+		t.Fatalf("ReadStreamE returned %v, %v for existing stream", stream, err)
+	}
+}
+
+// Tests that declared inputs that roverd did not resolve yield unavailable streams
+func TestOptionalInputs(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "controller", "version": "1.0.1",
+		"inputs": [{"service": "lidar", "streams": [{"name": "distance"}]}],
+		"outputs": [], "configuration": [], "tuning": {"enabled": false},
+		"service": {"inputs": [{"service": "lidar", "streams": ["distance"]}, {"service": "sonar", "streams": ["distance"]}]}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+	if err := service.Validate(); err != nil {
+		t.Fatalf("Validate returned %v", err)
+	}
+
+	for _, producer := range []string{"lidar", "sonar"} {
+		stream, err := service.ReadStreamE(producer, "distance")
+		if err != nil {
+			t.Fatalf("ReadStreamE(%s) returned %v", producer, err)
+		}
+		if stream.Available() {
+			t.Fatalf("Expected stream from %s to be unavailable", producer)
+		}
+		if _, err := stream.ReadBytes(); !errors.Is(err, ErrStreamUnavailable) {
+			t.Fatalf("ReadBytes returned %v, want ErrStreamUnavailable", err)
+		}
+	}
+}
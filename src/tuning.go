@@ -0,0 +1,260 @@
+//
+// Supervised subscriber that receives OTA tuning values from the tuning service and applies them to the configuration
+// it backs off (with jitter) when the tuning service cannot be reached and recreates its socket after repeated receive errors
+//
+
+package roverlib
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/tuning"
+	"github.com/pebbe/zmq4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// The state of the connection to the tuning service
+type ConnectionState string
+
+const (
+	TuningDisabled   ConnectionState = "disabled"
+	TuningConnecting ConnectionState = "connecting"
+	TuningConnected  ConnectionState = "connected"
+	TuningBackoff    ConnectionState = "backoff"
+)
+
+// Backoff between attempts to (re)create the tuning socket
+const minTuningBackoff = 100 * time.Millisecond
+const maxTuningBackoff = 30 * time.Second
+
+// After this many consecutive receive errors, the socket is recreated
+const maxTuningRecvErrors = 5
+
+// Errors are logged at most once per period, to avoid flooding the log when the tuning service is down
+var tuningSampler = &zerolog.BurstSampler{
+	Burst:  1,
+	Period: 10 * time.Second,
+}
+
+// Returns the sampled logger for tuning errors. It is derived from the global logger on every call, so that it uses the
+// output and format that were set up after the package was initialized.
+func tuningLog() *zerolog.Logger {
+	logger := log.Logger.Sample(tuningSampler)
+	return &logger
+}
+
+type tuningSubscriber struct {
+	address string
+	config  *ServiceConfiguration
+	state   atomic.Value // ConnectionState
+	// Incremented for every socket, so that late events of a closed socket do not overwrite the state
+	generation atomic.Uint64
+}
+
+func newTuningSubscriber(address string, config *ServiceConfiguration) *tuningSubscriber {
+	t := &tuningSubscriber{
+		address: address,
+		config:  config,
+	}
+	t.state.Store(TuningConnecting)
+	return t
+}
+
+func (t *tuningSubscriber) getState() ConnectionState {
+	return t.state.Load().(ConnectionState)
+}
+
+// Returns the time to wait before the given (zero-based) attempt, exponentially increasing with jitter
+func tuningBackoff(attempt int) time.Duration {
+	backoff := maxTuningBackoff
+	if attempt < 20 {
+		backoff = minTuningBackoff << attempt
+	}
+	if backoff > maxTuningBackoff {
+		backoff = maxTuningBackoff
+	}
+	// Wait at least half of the backoff, the rest is random so that services do not reconnect in lockstep
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Create a socket that is subscribed to all tuning messages. Connecting happens in the background, so the connection
+// state is driven by the events of the socket.
+func (t *tuningSubscriber) connect() (*zmq4.Socket, error) {
+	socket, err := zmq4.NewSocket(zmq4.SUB)
+	if err != nil {
+		return nil, err
+	}
+	// ZeroMQ keeps reconnecting while the tuning service is down, backing off up to the maximum
+	err = socket.SetReconnectIvl(minTuningBackoff)
+	if err == nil {
+		err = socket.SetReconnectIvlMax(maxTuningBackoff)
+	}
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+	events := zmq4.EVENT_CONNECTED | zmq4.EVENT_DISCONNECTED | zmq4.EVENT_CONNECT_RETRIED
+	if security != nil {
+		err = security.client(socket, tuningPeer)
+		if err != nil {
+			socket.Close()
+			return nil, err
+		}
+		events |= handshakeEvents
+	}
+	generation := t.generation.Add(1)
+	err = monitorSocket(socket, "tuning", events, func(event zmq4.Event, peer string) {
+		if t.generation.Load() == generation {
+			t.handleEvent(event, peer)
+		}
+	})
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+	err = socket.Connect(t.address)
+	if err != nil {
+		discardSocket(socket)
+		return nil, err
+	}
+	err = socket.SetSubscribe("")
+	if err != nil {
+		discardSocket(socket)
+		return nil, err
+	}
+	return socket, nil
+}
+
+// Update the connection state on an event of the tuning socket
+func (t *tuningSubscriber) handleEvent(event zmq4.Event, peer string) {
+	switch event {
+	case zmq4.EVENT_CONNECTED:
+		// With CurveZMQ, values can only be received once the handshake succeeded
+		if security == nil {
+			log.Info().Msgf("Connected to OTA tuning service at %s", t.address)
+			t.state.Store(TuningConnected)
+		}
+	case zmq4.EVENT_HANDSHAKE_SUCCEEDED:
+		reportHandshake(event, "tuning", peer, nil)
+		log.Info().Msgf("Connected to OTA tuning service at %s", t.address)
+		t.state.Store(TuningConnected)
+	case zmq4.EVENT_DISCONNECTED:
+		tuningLog().Warn().Msgf("Disconnected from OTA tuning service at %s", t.address)
+		t.state.Store(TuningConnecting)
+	case zmq4.EVENT_CONNECT_RETRIED:
+		t.state.Store(TuningBackoff)
+	default:
+		reportHandshake(event, "tuning", peer, nil)
+	}
+}
+
+// Receive tuning values until the socket fails repeatedly
+func (t *tuningSubscriber) receive(socket *zmq4.Socket) {
+	recvErrors := 0
+	for recvErrors < maxTuningRecvErrors {
+		log.Debug().Msg("Waiting for new tuning values")
+		// Receive new configuration, and update this in the shared configuration
+		res, err := socket.RecvBytes(0)
+		if err != nil {
+			recvErrors++
+			tuningLog().Err(err).Int("errors", recvErrors).Msg("Failed to receive tuning values")
+			continue
+		}
+		recvErrors = 0
+		log.Info().Msg("Received new tuning values")
+
+		// Convert from over-the-wire format to Go struct, using protobuf
+		var tuning rovercom.TuningState
+		err = proto.Unmarshal(res, &tuning)
+		if err != nil {
+			log.Err(err).Msg("Failed to unmarshal tuning values")
+			continue
+		}
+
+		t.config.applyTuning(&tuning)
+	}
+	tuningLog().Warn().Msg("Too many receive errors, recreating socket for OTA tuning")
+}
+
+// Keep subscribed to the tuning service until the process terminates
+func (t *tuningSubscriber) run() {
+	attempt := 0
+	for {
+		t.state.Store(TuningConnecting)
+		log.Debug().Msgf("Attempting to subscribe to OTA tuning service at %s", t.address)
+		// Initialize zmq socket to retrieve OTA tuning values from the service responsible for this
+		socket, err := t.connect()
+		if err != nil {
+			backoff := tuningBackoff(attempt)
+			tuningLog().Err(err).Dur("backoff", backoff).Msg("Failed to subscribe to OTA tuning service")
+			t.state.Store(TuningBackoff)
+			time.Sleep(backoff)
+			attempt++
+			continue
+		}
+
+		log.Debug().Msgf("Subscribed to OTA tuning service at %s", t.address)
+		attempt = 0
+		t.receive(socket)
+		t.generation.Add(1)
+		socket.Close()
+
+		// Do not recreate the socket straight away, the failure might persist
+		t.state.Store(TuningBackoff)
+		time.Sleep(tuningBackoff(attempt))
+		attempt++
+	}
+}
+
+// Apply a tuning state received from the tuning service as a single transaction, so that readers never see half of an update
+// (setFromXLocked will ignore values that are not tunable, and convert values to the type of their option)
+func (c *ServiceConfiguration) applyTuning(tuning *rovercom.TuningState) {
+	c.lock.Lock()
+	if !c.beginUpdateLocked(tuning.Timestamp) {
+		c.lock.Unlock()
+		return
+	}
+
+	changes := make([]*ConfigChange, 0, len(tuning.DynamicParameters))
+	for _, p := range tuning.DynamicParameters {
+		// This is certainly not pretty, but unions are not straightforward in Go
+		if p.GetNumber() != nil {
+			log.Info().Str("key", p.GetNumber().Key).Float32("value", p.GetNumber().Value).Msg("Setting tuning value")
+			changes = append(changes, c.setFromNumberLocked(p.GetNumber().Key, float64(p.GetNumber().Value)))
+		} else if p.GetString_() != nil {
+			log.Info().Str("key", p.GetString_().Key).Str("value", p.GetString_().Value).Msg("Setting tuning value")
+			changes = append(changes, c.setFromStringLocked(p.GetString_().Key, p.GetString_().Value))
+		} else {
+			log.Warn().Msg("Unknown tuning value type")
+		}
+	}
+	c.lock.Unlock()
+
+	stamp(changes, sourceTuning)
+	c.notify(changes...)
+}
+
+// Start a new update with the given timestamp, unless it is outdated. The caller must hold the write lock.
+func (c *ServiceConfiguration) beginUpdateLocked(timestamp uint64) bool {
+	// Is the timestamp later than the last update?
+	if timestamp <= c.lastUpdate {
+		log.Info().Msg("Received new tuning values with an outdated timestamp, ignoring...")
+		return false
+	}
+	c.lastUpdate = timestamp
+	c.version++
+	return true
+}
+
+// Returns the state of the connection to the OTA tuning service
+func (c *ServiceConfiguration) TuningConnection() ConnectionState {
+	if c.tuning == nil {
+		return TuningDisabled
+	}
+	return c.tuning.getState()
+}
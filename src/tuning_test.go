@@ -0,0 +1,86 @@
+package roverlib
+
+import (
+	"testing"
+	"time"
+
+	rovercom "github.com/VU-ASE/rovercom/v2/packages/go/tuning"
+	"github.com/pebbe/zmq4"
+)
+
+// helper: build a tuning state that sets a single number parameter
+func numberTuning(timestamp uint64, key string, value float32) *rovercom.TuningState {
+	return &rovercom.TuningState{
+		Timestamp: timestamp,
+		DynamicParameters: []*rovercom.TuningState_Parameter{
+			{Parameter: &rovercom.TuningState_Parameter_Number{
+				Number: &rovercom.TuningState_Parameter_NumberParameter{Key: key, Value: value},
+			}},
+		},
+	}
+}
+
+// Tests that the backoff grows exponentially, stays within bounds and is jittered
+func TestTuningBackoff(t *testing.T) {
+	for attempt := 0; attempt < 40; attempt++ {
+		backoff := tuningBackoff(attempt)
+		if backoff < minTuningBackoff/2 || backoff > maxTuningBackoff {
+			t.Fatalf("tuningBackoff(%d) = %v, out of bounds", attempt, backoff)
+		}
+	}
+	if tuningBackoff(5) < tuningBackoff(0)*8 {
+		t.Fatalf("tuningBackoff should grow exponentially")
+	}
+	if tuningBackoff(100) < maxTuningBackoff/2 {
+		t.Fatalf("tuningBackoff should saturate at the maximum backoff")
+	}
+}
+
+// Tests that tuning states are applied in timestamp order, and outdated ones are ignored
+func TestApplyTuningTimestampOrder(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	now := uint64(time.Now().UnixMilli())
+
+	cfg.applyTuning(numberTuning(now+1000, "config1", 1.5))
+	if v, _ := cfg.GetFloat("config1"); v != 1.5 {
+		t.Fatalf("config1 = %v, want 1.5", v)
+	}
+
+	cfg.applyTuning(numberTuning(now+500, "config1", 2.5))
+	if v, _ := cfg.GetFloat("config1"); v != 1.5 {
+		t.Fatalf("outdated tuning state was applied: config1 = %v, want 1.5", v)
+	}
+}
+
+// Tests that the connection state is reported as disabled when there is no subscriber
+func TestTuningConnectionDisabled(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	if state := cfg.TuningConnection(); state != TuningDisabled {
+		t.Fatalf("TuningConnection() = %q, want %q", state, TuningDisabled)
+	}
+
+	cfg.tuning = newTuningSubscriber("tcp://unix:8829", cfg)
+	if state := cfg.TuningConnection(); state != TuningConnecting {
+		t.Fatalf("TuningConnection() = %q, want %q", state, TuningConnecting)
+	}
+}
+
+// Tests that the connection state follows the events of the tuning socket, as connecting itself always succeeds
+func TestTuningConnectionEvents(t *testing.T) {
+	cfg := NewServiceConfiguration(sampleService())
+	cfg.tuning = newTuningSubscriber("tcp://unix:8829", cfg)
+
+	for _, step := range []struct {
+		event zmq4.Event
+		want  ConnectionState
+	}{
+		{zmq4.EVENT_CONNECT_RETRIED, TuningBackoff},
+		{zmq4.EVENT_CONNECTED, TuningConnected},
+		{zmq4.EVENT_DISCONNECTED, TuningConnecting},
+	} {
+		cfg.tuning.handleEvent(step.event, "")
+		if state := cfg.TuningConnection(); state != step.want {
+			t.Fatalf("TuningConnection() = %q after event %v, want %q", state, step.event, step.want)
+		}
+	}
+}
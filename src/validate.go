@@ -0,0 +1,261 @@
+//
+// Validation of the service definition (bootspec) as injected by roverd, so that a malformed definition is reported
+// with all of its problems at once, instead of crashing on the first missing field
+//
+
+package roverlib
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Service names can only contain lowercase letters and hyphens
+var serviceNamePattern = regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`)
+
+// Versions are semantic versions (e.g. 1.0.1)
+var versionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// All problems found in a service definition
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d problem(s) in service definition:\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Check the service definition for missing fields, invalid names and addresses, duplicates and values that do not match their type.
+// Returns a *ValidationError with all problems, or nil if the definition is valid.
+func (s *Service) Validate() error {
+	problems := &ValidationError{}
+
+	if s.Name == nil || *s.Name == "" {
+		problems.add("name is required")
+	} else if !serviceNamePattern.MatchString(*s.Name) {
+		problems.add("name %q can only contain lowercase letters and hyphens", *s.Name)
+	}
+	if s.Version == nil || *s.Version == "" {
+		problems.add("version is required")
+	} else if !versionPattern.MatchString(*s.Version) {
+		problems.add("version %q is not a semantic version (e.g. 1.0.1)", *s.Version)
+	}
+
+	// Distinguish between missing (nil) and empty lists, roverd always sends all of them
+	if s.Inputs == nil {
+		problems.add("inputs is required")
+	}
+	if s.Outputs == nil {
+		problems.add("outputs is required")
+	}
+	if s.Configuration == nil {
+		problems.add("configuration is required")
+	}
+
+	for i, input := range s.Inputs {
+		if input.Service == nil || *input.Service == "" {
+			problems.add("inputs[%d].service is required", i)
+		}
+		for j, stream := range input.Streams {
+			if stream.Name == nil || *stream.Name == "" {
+				problems.add("inputs[%d].streams[%d].name is required", i, j)
+			}
+			// Inputs without an address are optional inputs that roverd did not resolve
+			if stream.Address != nil && *stream.Address != "" {
+				if err := validateAddress(*stream.Address); err != nil {
+					problems.add("inputs[%d].streams[%d].address: %v", i, j, err)
+				}
+			}
+		}
+	}
+
+	outputs := make(map[string]bool)
+	for i, output := range s.Outputs {
+		if output.Name == nil || *output.Name == "" {
+			problems.add("outputs[%d].name is required", i)
+		} else if outputs[*output.Name] {
+			problems.add("outputs[%d].name %q is a duplicate", i, *output.Name)
+		} else {
+			outputs[*output.Name] = true
+		}
+		if output.Address == nil || *output.Address == "" {
+			problems.add("outputs[%d].address is required", i)
+		} else if err := validateAddress(*output.Address); err != nil {
+			problems.add("outputs[%d].address: %v", i, err)
+		}
+		if output.Compression != nil && output.Compression.Codec != nil {
+			if _, err := ParseCodec(*output.Compression.Codec); err != nil {
+				problems.add("outputs[%d].compression.codec: %v", i, err)
+			}
+		}
+	}
+
+	options := make(map[string]bool)
+	for i, c := range s.Configuration {
+		if c.Name == nil || *c.Name == "" {
+			problems.add("configuration[%d].name is required", i)
+		} else if options[*c.Name] {
+			problems.add("configuration[%d].name %q is a duplicate", i, *c.Name)
+		} else {
+			options[*c.Name] = true
+		}
+		if c.Type == nil {
+			problems.add("configuration[%d].type is required", i)
+		} else if c.Value == nil {
+			problems.add("configuration[%d].value is required", i)
+		} else if err := validateValue(*c.Type, *c.Value); err != nil {
+			problems.add("configuration[%d].value: %v", i, err)
+		}
+		if c.Constraints != nil {
+			if _, err := compileConstraint(*c.Constraints); err != nil {
+				problems.add("configuration[%d].constraints: %v", i, err)
+			}
+		}
+	}
+
+	if s.Tuning.Enabled == nil {
+		problems.add("tuning.enabled is required")
+	} else if *s.Tuning.Enabled {
+		if s.Tuning.Address == nil || *s.Tuning.Address == "" {
+			problems.add("tuning.address is required when tuning is enabled")
+		} else if err := validateAddress(*s.Tuning.Address); err != nil {
+			problems.add("tuning.address: %v", err)
+		}
+	}
+
+	if s.Heartbeat != nil && s.Heartbeat.Enabled != nil && *s.Heartbeat.Enabled {
+		if s.Heartbeat.Address == nil || *s.Heartbeat.Address == "" {
+			problems.add("heartbeat.address is required when heartbeats are enabled")
+		} else if err := validateAddress(*s.Heartbeat.Address); err != nil {
+			problems.add("heartbeat.address: %v", err)
+		}
+	}
+
+	if s.Rewiring != nil && s.Rewiring.Address != nil {
+		if err := validateAddress(*s.Rewiring.Address); err != nil {
+			problems.add("rewiring.address: %v", err)
+		}
+	}
+
+	if s.Security != nil {
+		if s.Security.Public != nil {
+			if err := validateCurveKey(*s.Security.Public); err != nil {
+				problems.add("security.public: %v", err)
+			}
+		}
+		if s.Security.Secret != nil {
+			if err := validateCurveKey(*s.Security.Secret); err != nil {
+				problems.add("security.secret: %v", err)
+			}
+		}
+	}
+
+	endpoints := make(map[string]bool)
+	for i, endpoint := range s.Endpoints {
+		if endpoint.Name == nil || *endpoint.Name == "" {
+			problems.add("endpoints[%d].name is required", i)
+		} else if endpoints[*endpoint.Name] {
+			problems.add("endpoints[%d].name %q is a duplicate", i, *endpoint.Name)
+		} else {
+			endpoints[*endpoint.Name] = true
+		}
+		if endpoint.Address == nil || *endpoint.Address == "" {
+			problems.add("endpoints[%d].address is required", i)
+		} else if err := validateAddress(*endpoint.Address); err != nil {
+			problems.add("endpoints[%d].address: %v", i, err)
+		}
+	}
+	for i, request := range s.Requests {
+		if request.Service == nil || *request.Service == "" {
+			problems.add("requests[%d].service is required", i)
+		}
+		for j, endpoint := range request.Endpoints {
+			if endpoint.Name == nil || *endpoint.Name == "" {
+				problems.add("requests[%d].endpoints[%d].name is required", i, j)
+			}
+			if endpoint.Address == nil || *endpoint.Address == "" {
+				problems.add("requests[%d].endpoints[%d].address is required", i, j)
+			} else if err := validateAddress(*endpoint.Address); err != nil {
+				problems.add("requests[%d].endpoints[%d].address: %v", i, j, err)
+			}
+		}
+	}
+
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Check that an address is a valid zmq address (tcp://host:port, ipc://path or inproc://name)
+func validateAddress(address string) error {
+	transport, endpoint, ok := strings.Cut(address, "://")
+	if !ok || endpoint == "" {
+		return fmt.Errorf("%q is not of the form transport://endpoint", address)
+	}
+	switch transport {
+	case "tcp":
+		i := strings.LastIndex(endpoint, ":")
+		if i <= 0 {
+			return fmt.Errorf("%q has no host and port", address)
+		}
+		port, err := strconv.Atoi(endpoint[i+1:])
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("%q has an invalid port", address)
+		}
+	case "ipc", "inproc":
+	default:
+		return fmt.Errorf("%q has unsupported transport %q", address, transport)
+	}
+	return nil
+}
+
+// Check that a value matches its declared type
+func validateValue(t Type, value Value) error {
+	switch t {
+	case Number:
+		if value.Double == nil {
+			return fmt.Errorf("expected a number")
+		}
+	case String:
+		if value.String == nil {
+			return fmt.Errorf("expected a string")
+		}
+	case Integer:
+		if value.Double == nil || *value.Double != math.Trunc(*value.Double) {
+			return fmt.Errorf("expected an integer")
+		}
+	case Boolean:
+		if value.Bool == nil {
+			return fmt.Errorf("expected a boolean")
+		}
+	case NumberArray:
+		if value.Array == nil {
+			return fmt.Errorf("expected an array of numbers")
+		}
+		for _, v := range value.Array {
+			if v.Double == nil {
+				return fmt.Errorf("expected an array of numbers")
+			}
+		}
+	case StringArray:
+		if value.Array == nil {
+			return fmt.Errorf("expected an array of strings")
+		}
+		for _, v := range value.Array {
+			if v.String == nil {
+				return fmt.Errorf("expected an array of strings")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown type %q", t)
+	}
+	return nil
+}
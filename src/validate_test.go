@@ -0,0 +1,78 @@
+package roverlib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests that a complete service definition is valid
+func TestValidateValid(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "controller", "version": "1.0.1",
+		"inputs": [{"service": "imaging", "streams": [{"name": "track-data", "address": "tcp://localhost:7890"}]}],
+		"outputs": [{"name": "motor-movement", "address": "tcp://*:7882"}],
+		"configuration": [{"name": "speed", "type": "number", "tunable": true, "value": 1.5}],
+		"tuning": {"enabled": false}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+	if err := service.Validate(); err != nil {
+		t.Fatalf("Validate returned %v", err)
+	}
+}
+
+// Tests that all problems are reported at once
+func TestValidateAggregatesProblems(t *testing.T) {
+	service, err := UnmarshalService([]byte(`{
+		"name": "Controller!", "version": "v1.0",
+		"inputs": [{"service": "imaging", "streams": [{"name": "track-data", "address": "unix:7890"}]}],
+		"outputs": [
+			{"name": "motor-movement", "address": "tcp://*:7882"},
+			{"name": "motor-movement", "address": "tcp://*:99999"}
+		],
+		"configuration": [
+			{"name": "speed", "type": "number", "value": "fast"},
+			{"name": "speed", "type": "integer", "value": 1.5}
+		],
+		"tuning": {"enabled": true}
+	}`))
+	if err != nil {
+		t.Fatalf("UnmarshalService returned %v", err)
+	}
+
+	err = service.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate returned %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"name \"Controller!\"",
+		"version \"v1.0\"",
+		"inputs[0].streams[0].address",
+		"outputs[1].name \"motor-movement\" is a duplicate",
+		"outputs[1].address",
+		"configuration[0].value: expected a number",
+		"configuration[1].name \"speed\" is a duplicate",
+		"configuration[1].value: expected an integer",
+		"tuning.address is required",
+	}
+	if len(validationErr.Problems) != len(want) {
+		t.Fatalf("got %d problems, want %d:\n%v", len(validationErr.Problems), len(want), err)
+	}
+	for i, problem := range validationErr.Problems {
+		if !strings.Contains(problem, want[i]) {
+			t.Fatalf("problem %d = %q, want it to mention %q", i, problem, want[i])
+		}
+	}
+}
+
+// Tests that an empty definition reports all required fields, and that building a configuration from it does not crash
+func TestValidateEmpty(t *testing.T) {
+	service, _ := UnmarshalService([]byte(`{"configuration": [{"name": "speed"}]}`))
+	if err := service.Validate(); err == nil {
+		t.Fatalf("expected Validate to fail for an empty definition")
+	}
+	NewServiceConfiguration(service)
+}
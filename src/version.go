@@ -0,0 +1,107 @@
+//
+// Versioning of the service definition (bootspec) schema, so that a roverd upgrade cannot silently break services
+// that were built against an older roverlib-go
+//
+
+package roverlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The bootspec schema version that this library was built against, assumed when roverd does not send a version
+const BootspecVersion = "1.0"
+
+// The major bootspec versions that this library can parse. Minor versions only add fields, which are reported by UnknownFields
+var supportedBootspecMajors = map[int]bool{1: true}
+
+// Returns the bootspec schema version of the service definition
+func (s *Service) SchemaVersion() string {
+	if s.Bootspec == nil || *s.Bootspec == "" {
+		return BootspecVersion
+	}
+	return *s.Bootspec
+}
+
+// Check that the bootspec schema version of the service definition can be understood by this library
+func (s *Service) checkCompatibility() error {
+	version := s.SchemaVersion()
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return fmt.Errorf("invalid bootspec version %q", version)
+	}
+	if !supportedBootspecMajors[major] {
+		return fmt.Errorf("bootspec version %s is not supported by this version of roverlib-go (which supports %s), rebuild this service against a compatible roverlib-go", version, supportedMajors())
+	}
+	return nil
+}
+
+func supportedMajors() string {
+	majors := make([]string, 0, len(supportedBootspecMajors))
+	for major := range supportedBootspecMajors {
+		majors = append(majors, fmt.Sprintf("%d.x", major))
+	}
+	sort.Strings(majors)
+	return strings.Join(majors, ", ")
+}
+
+// Returns the paths (e.g. "outputs[0].priority") of all fields in the service definition that this library does not know,
+// these are ignored but might indicate that the service was built against an older roverlib-go
+func UnknownFields(data []byte) []string {
+	return unknownFields(data, reflect.TypeOf(Service{}), "")
+}
+
+func unknownFields(data json.RawMessage, t reflect.Type, path string) []string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return unknownFields(data, t.Elem(), path)
+	case reflect.Slice:
+		var elements []json.RawMessage
+		if json.Unmarshal(data, &elements) != nil {
+			return nil
+		}
+		var unknown []string
+		for i, e := range elements {
+			unknown = append(unknown, unknownFields(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return unknown
+	case reflect.Struct:
+		// Unions (e.g. Value) take care of their own fields
+		if reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return nil
+		}
+		known := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				known[name] = t.Field(i).Type
+			}
+		}
+
+		var unknown []string
+		for name, value := range fields {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			fieldType, ok := known[name]
+			if !ok {
+				unknown = append(unknown, fieldPath)
+				continue
+			}
+			unknown = append(unknown, unknownFields(value, fieldType, fieldPath)...)
+		}
+		sort.Strings(unknown)
+		return unknown
+	}
+	return nil
+}
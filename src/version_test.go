@@ -0,0 +1,42 @@
+package roverlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that all minor versions of the current major bootspec version are accepted, and others are refused
+func TestBootspecCompatibility(t *testing.T) {
+	for _, definition := range []string{`{}`, `{"bootspec": "1.0"}`, `{"bootspec": "1.3"}`} {
+		if _, err := UnmarshalService([]byte(definition)); err != nil {
+			t.Fatalf("UnmarshalService(%s) returned %v", definition, err)
+		}
+	}
+	for _, definition := range []string{`{"bootspec": "2.0"}`, `{"bootspec": "3.0"}`, `{"bootspec": "0.1"}`, `{"bootspec": "latest"}`} {
+		if _, err := UnmarshalService([]byte(definition)); err == nil {
+			t.Fatalf("UnmarshalService(%s) should refuse the version", definition)
+		}
+	}
+
+	service, _ := UnmarshalService([]byte(`{}`))
+	if service.SchemaVersion() != BootspecVersion {
+		t.Fatalf("SchemaVersion() = %q, want %q", service.SchemaVersion(), BootspecVersion)
+	}
+}
+
+// Tests that unknown fields are reported with their path, also in nested objects
+func TestUnknownFields(t *testing.T) {
+	unknown := UnknownFields([]byte(`{
+		"name": "controller",
+		"as": "Controller",
+		"outputs": [{"name": "motor-movement", "address": "tcp://*:7882", "priority": "high"}],
+		"configuration": [{"name": "speed", "type": "number", "value": 1.5}],
+		"tuning": {"enabled": false, "interval": 5},
+		"service": {"author": "anyone"}
+	}`))
+
+	want := []string{"as", "outputs[0].priority", "tuning.interval"}
+	if !reflect.DeepEqual(unknown, want) {
+		t.Fatalf("UnknownFields() = %v, want %v", unknown, want)
+	}
+}